@@ -0,0 +1,150 @@
+package btree
+
+import (
+	"iter"
+)
+
+type boundKind uint8
+
+const (
+	boundUnbounded boundKind = iota
+	boundIncluded
+	boundExcluded
+)
+
+// Bounds is one end of a range of keys, which includes or excludes a key or is unbounded.
+// The zero value is unbounded. Unlike the nil bounds of Range, a nil key is a key like any other.
+type Bounds struct {
+	key  Bytes
+	kind boundKind
+}
+
+// Included returns a bound that includes key
+func Included(key Bytes) Bounds {
+	return Bounds{key: key, kind: boundIncluded}
+}
+
+// Excluded returns a bound that excludes key
+func Excluded(key Bytes) Bounds {
+	return Bounds{key: key, kind: boundExcluded}
+}
+
+// Unbounded returns a bound that doesn't limit its side of the range
+func Unbounded() Bounds {
+	return Bounds{}
+}
+
+// nilBounds converts the bounds of Range, where low is inclusive, high is exclusive and nil is unbounded
+func nilBounds(low, high Bytes) (lo, hi Bounds) {
+	if low != nil {
+		lo = Included(low)
+	}
+	if high != nil {
+		hi = Excluded(high)
+	}
+	return lo, hi
+}
+
+// admitsAbove reports whether key is within b used as a lower bound
+func (b Bounds) admitsAbove(key Bytes, cmp Comparator) bool {
+	switch b.kind {
+	case boundIncluded:
+		return cmp(key, b.key) >= 0
+	case boundExcluded:
+		return cmp(key, b.key) > 0
+	}
+	return true
+}
+
+// admitsBelow reports whether key is within b used as an upper bound
+func (b Bounds) admitsBelow(key Bytes, cmp Comparator) bool {
+	switch b.kind {
+	case boundIncluded:
+		return cmp(key, b.key) <= 0
+	case boundExcluded:
+		return cmp(key, b.key) < 0
+	}
+	return true
+}
+
+// seekLow positions the cursor at the smallest key within lo used as a lower bound
+func (c *cursor[E]) seekLow(lo Bounds) bool {
+	switch lo.kind {
+	case boundIncluded:
+		c.seekLeaf(lo.key)
+		if c.idx >= c.leaf.len() {
+			return c.nextLeaf()
+		}
+		return true
+	case boundExcluded:
+		return c.seekAfter(lo.key)
+	}
+	return c.First()
+}
+
+// seekHigh positions the cursor at the largest key within hi used as an upper bound
+func (c *cursor[E]) seekHigh(hi Bounds) bool {
+	switch hi.kind {
+	case boundIncluded:
+		return c.seekFloor(hi.key)
+	case boundExcluded:
+		return c.SeekBefore(hi.key)
+	}
+	return c.Last()
+}
+
+// seekAfter positions the cursor at the smallest key that is strictly larger than key
+func (c *cursor[E]) seekAfter(key Bytes) bool {
+	c.seekLeaf(key)
+	if c.Valid() && c.tree.ctx.compare(c.Key(), key) == 0 {
+		return c.Next()
+	}
+	if c.idx >= c.leaf.len() {
+		return c.nextLeaf()
+	}
+	return true
+}
+
+// seekFloor positions the cursor at the largest key that is smaller than or equal to key
+func (c *cursor[E]) seekFloor(key Bytes) bool {
+	c.seekLeaf(key)
+	if c.Valid() && c.tree.ctx.compare(c.Key(), key) == 0 {
+		return true
+	}
+	return c.Prev()
+}
+
+// rangeBounds iterates over the pairs of t with keys between lo and hi in ascending order
+func rangeBounds[E any](t *treeCore[E], lo, hi Bounds) iter.Seq2[Bytes, E] {
+	return func(yield func(Bytes, E) bool) {
+		c, cmp := newCursor(t), t.ctx.comparator()
+		// keys are read once per step, as reading a compressed key allocates it
+		for ok := c.seekLow(lo); ok; ok = c.Next() {
+			if k := c.Key(); !hi.admitsBelow(k, cmp) || !yield(k, c.value()) {
+				break
+			}
+		}
+	}
+}
+
+// backwardBounds iterates over the pairs of t with keys between lo and hi in descending order
+func backwardBounds[E any](t *treeCore[E], lo, hi Bounds) iter.Seq2[Bytes, E] {
+	return func(yield func(Bytes, E) bool) {
+		c, cmp := newCursor(t), t.ctx.comparator()
+		for ok := c.seekHigh(hi); ok; ok = c.Prev() {
+			if k := c.Key(); !lo.admitsAbove(k, cmp) || !yield(k, c.value()) {
+				break
+			}
+		}
+	}
+}
+
+// RangeBounds iterates over the pairs with keys between lo and hi in ascending order
+func (b *BTree[V]) RangeBounds(lo, hi Bounds) iter.Seq2[Bytes, *V] {
+	return rangeBounds(&b.treeCore, lo, hi)
+}
+
+// BackwardBounds iterates over the pairs with keys between lo and hi in descending order
+func (b *BTree[V]) BackwardBounds(lo, hi Bounds) iter.Seq2[Bytes, *V] {
+	return backwardBounds(&b.treeCore, lo, hi)
+}
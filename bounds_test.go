@@ -0,0 +1,114 @@
+package btree
+
+import (
+	"bytes"
+	"iter"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// randomBounds returns a bound of a random kind for a key chosen by randomBound
+func randomBounds(keys []Bytes) Bounds {
+	k := randomBound(keys)
+	switch {
+	case k == nil:
+		return Unbounded()
+	case rand.Intn(2) == 0:
+		return Included(k)
+	}
+	return Excluded(k)
+}
+
+func collectKeys[V any](seq iter.Seq2[Bytes, V]) []Bytes {
+	var keys []Bytes
+	for k := range seq {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// RangeBounds and BackwardBounds must yield the keys within the bounds for every kind of bound,
+// in both directions, through the batches of ConcurrentBTree and through the cursor of ValueBTree
+func TestRangeBounds(t *testing.T) {
+	b := NewBTree[int](4, 4)
+	c := NewConcurrentBTree[int](4, 4)
+	v, err := NewValueBTree[int](4, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keys := sortedTestKeys(1000)
+	for i, k := range keys {
+		b.SetOp(k, &i)
+		c.SetOp(k, &i)
+		if err := v.Set(k, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	cmp := b.ctx.comparator()
+
+	for range 500 {
+		lo, hi := randomBounds(keys), randomBounds(keys)
+		var want []Bytes
+		for _, k := range keys {
+			if lo.admitsAbove(k, cmp) && hi.admitsBelow(k, cmp) {
+				want = append(want, k)
+			}
+		}
+		backward := slices.Clone(want)
+		slices.Reverse(backward)
+
+		for name, got := range map[string][]Bytes{
+			"forward":            collectKeys(b.RangeBounds(lo, hi)),
+			"concurrent forward": collectKeys(c.RangeBounds(lo, hi)),
+			"value forward":      collectKeys(v.RangeBounds(lo, hi)),
+		} {
+			if !slices.EqualFunc(got, want, bytes.Equal) {
+				t.Fatalf("%s %v..%v: got %d keys, want %d", name, lo, hi, len(got), len(want))
+			}
+		}
+		for name, got := range map[string][]Bytes{
+			"backward":            collectKeys(b.BackwardBounds(lo, hi)),
+			"concurrent backward": collectKeys(c.BackwardBounds(lo, hi)),
+			"value backward":      collectKeys(v.BackwardBounds(lo, hi)),
+		} {
+			if !slices.EqualFunc(got, backward, bytes.Equal) {
+				t.Fatalf("%s %v..%v: got %d keys, want %d", name, lo, hi, len(got), len(backward))
+			}
+		}
+	}
+}
+
+func TestRangeBoundsEdges(t *testing.T) {
+	b := NewBTree[int](4, 4)
+	if got := collectKeys(b.RangeBounds(Unbounded(), Unbounded())); len(got) != 0 {
+		t.Fatalf("empty tree yielded %d keys", len(got))
+	}
+
+	keys := []Bytes{{}, {1}, {2}, {3}}
+	for i, k := range keys {
+		b.SetOp(k, &i)
+	}
+	tests := []struct {
+		lo, hi Bounds
+		want   []Bytes
+	}{
+		{Included(nil), Excluded(Bytes{1}), []Bytes{{}}},
+		{Excluded(nil), Unbounded(), []Bytes{{1}, {2}, {3}}},
+		{Included(Bytes{1}), Included(Bytes{3}), []Bytes{{1}, {2}, {3}}},
+		{Excluded(Bytes{1}), Excluded(Bytes{3}), []Bytes{{2}}},
+		{Excluded(Bytes{2}), Excluded(Bytes{2}), nil},
+		{Included(Bytes{3}), Included(Bytes{1}), nil},
+		{Unbounded(), Unbounded(), keys},
+	}
+	for _, tt := range tests {
+		if got := collectKeys(b.RangeBounds(tt.lo, tt.hi)); !slices.EqualFunc(got, tt.want, bytes.Equal) {
+			t.Errorf("RangeBounds(%v, %v) = %v, want %v", tt.lo, tt.hi, got, tt.want)
+		}
+		want := slices.Clone(tt.want)
+		slices.Reverse(want)
+		if got := collectKeys(b.BackwardBounds(tt.lo, tt.hi)); !slices.EqualFunc(got, want, bytes.Equal) {
+			t.Errorf("BackwardBounds(%v, %v) = %v, want %v", tt.lo, tt.hi, got, want)
+		}
+	}
+}
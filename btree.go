@@ -1,89 +1,188 @@
 package btree
 
 import (
-	"bytes"
+	"errors"
+	"fmt"
 	"iter"
 )
 
+var (
+	ErrInvalidDegree = errors.New("btree: degree must be at least 3")
+	// ErrCorrupt is returned when a tree is found to break its invariants. The tree must not be used afterwards.
+	ErrCorrupt = errors.New("btree: corrupt tree")
+)
+
 // BTree is a general-propose B+ tree that takes byte arrays as key and supports arbitrary value types.
 // This is in contrast to Map, which hashes all keys before inserting them in the tree.
 type BTree[V any] struct {
-	root   Node[V] // root starts from being a *LeafNode[V] then changes to *InternalNode[V] after first split
-	deg    int     // defined as the number of pointers from each node
-	height int
-	stack  Stack[TraversalPositions[V]]
+	treeCore[*V] // leaves store pointers to values
+
+	encodeValue ValueEncoder[V] // encodes values for RootHash, nil for the default encoding
 }
 
-func NewBTree[V any](degree int, expectedHeight int) *BTree[V] {
-	// expectedHeight parameter helps reduce number of allocations for stack expansion
-	return &BTree[V]{
-		root:   newLeafNode[V](degree - 1),
-		deg:    degree,
-		height: 0,
-		stack:  NewStack[TraversalPositions[V]](expectedHeight),
+// Options configures a tree created with New
+type Options[V any] struct {
+	Degree         int             // maximum number of children of internal nodes, at least 3
+	ExpectedHeight int             // optional, used to size the traversal stack
+	Compare        Comparator      // optional, orders keys instead of bytes.Compare, see NewBTreeFunc
+	EncodeValue    ValueEncoder[V] // optional, encodes values for RootHash, see NewHashedBTree
+	// CopyKeys makes the tree copy inserted keys into memory it owns, so that callers can reuse their
+	// buffers after SetOp. Keys are stored contiguously in a slab per leaf, see LeafNode.storeKey.
+	CopyKeys bool
+	// CompressKeys makes nodes store the prefix shared by their keys or separators once, and only the rest
+	// of each one, which saves memory and comparisons when keys have long common prefixes. Keys are copied
+	// as with CopyKeys, and reading a key from a node that has a prefix rebuilds it, which allocates.
+	// Separators are also shortened to the shortest prefix that separates two leaves, so the RootHash of
+	// the tree differs from that of a tree with the same pairs without this option.
+	// It relies on byte order, so it can't be used with Compare.
+	CompressKeys bool
+}
+
+// New returns an empty tree configured by opts, or ErrInvalidDegree if the degree is less than 3
+func New[V any](opts Options[V]) (*BTree[V], error) {
+	if opts.Degree < 3 {
+		return nil, fmt.Errorf("%w, got %d", ErrInvalidDegree, opts.Degree)
 	}
+	if opts.CompressKeys && opts.Compare != nil {
+		return nil, errors.New("btree: CompressKeys can't be used with a comparator")
+	}
+	var ctx *treeContext
+	if opts.Compare != nil || opts.CopyKeys || opts.CompressKeys {
+		ctx = &treeContext{cmp: opts.Compare, copyKeys: opts.CopyKeys, compressKeys: opts.CompressKeys}
+	}
+	b := newBTree[V](opts.Degree, max(opts.ExpectedHeight, 0), ctx)
+	b.encodeValue = opts.EncodeValue
+	return b, nil
+}
+
+// NewBTree returns an empty tree. Degrees smaller than 3 are raised to 3, use New to have them reported.
+func NewBTree[V any](degree int, expectedHeight int) *BTree[V] {
+	return newBTree[V](max(degree, 3), max(expectedHeight, 0), nil)
+}
+
+// NewBTreeFunc returns a tree that orders keys with cmp instead of bytes.Compare, see NewBTree
+func NewBTreeFunc[V any](degree int, expectedHeight int, cmp Comparator) *BTree[V] {
+	return newBTree[V](max(degree, 3), max(expectedHeight, 0), &treeContext{cmp: cmp})
+}
+
+func newBTree[V any](degree int, expectedHeight int, ctx *treeContext) *BTree[V] {
+	return &BTree[V]{treeCore: newTreeCore[*V](degree, expectedHeight, ctx)}
 }
 
 func (b *BTree[V]) Degree() int {
 	return b.deg
 }
 
+// Len returns the number of keys in the tree in O(1) time
+func (b *BTree[V]) Len() int {
+	return b.count
+}
+
 func (b *BTree[V]) GetOp(key Bytes) *V {
-	return valueRef(b.root, key)
+	v, _ := lookup(b.root, key)
+	return v
 }
 
-// SetOp sets/inserts the given key-value pair in the map, and handles root node split if needed
-func (b *BTree[V]) SetOp(key Bytes, value *V) {
-	key, newNode := setOrInsert(b.root, key, value, b.stack)
-	if newNode != nil {
-		root := newInternalNode[V](b.deg)
-		root.keys = append(root.keys, key)
-		root.pointers = append(root.pointers, b.root, newNode)
+// Clone returns a copy of the tree in O(1) time. The two trees share all nodes, and each of them copies
+// the nodes on the path of a modification before making it, so that changes aren't visible in the other.
+// Clone must not be called concurrently with modifications of the tree, but after it returns both trees
+// can be used concurrently.
+func (b *BTree[V]) Clone() *BTree[V] {
+	return &BTree[V]{treeCore: b.clone(), encodeValue: b.encodeValue}
+}
 
-		b.root = root
-		b.height++
-		if cap(b.stack) < b.height {
-			b.stack = NewStack[TraversalPositions[V]](2 * b.height)
+// SetOp sets/inserts the given key-value pair in the map, and handles root node split if needed.
+// It returns ErrCorrupt if the tree breaks its invariants.
+func (b *BTree[V]) SetOp(key Bytes, value *V) error {
+	return b.finishInsert(setOrInsert(b.mutableRoot(), key, value, b.stack))
+}
+
+// DelOp deletes key from the tree and returns whether it was there.
+// It returns ErrCorrupt if the tree breaks its invariants.
+func (b *BTree[V]) DelOp(key Bytes) (bool, error) {
+	return b.finishDelete(deleteFromNode(b.mutableRoot(), key, b.stack))
+}
+
+// Rank returns the number of keys in the tree that are strictly smaller than key.
+func (b *BTree[V]) Rank(key Bytes) int {
+	rank := 0
+	n := b.root
+	for !n.isLeaf() {
+		ni := n.(*InternalNode[*V])
+		ci := ni.childIndexForKey(key)
+		for _, c := range ni.counts[:ci] {
+			rank += int(c)
 		}
+		n = ni.pointers[ci]
 	}
+	idx, _ := n.(*LeafNode[*V]).search(key)
+	return rank + idx
 }
 
-func (b *BTree[V]) DelOp(key Bytes) bool {
-	del := deleteFromNode(b.root, key, b.stack)
-	if del && !b.root.isLeaf() {
-		ri := b.root.(*InternalNode[V])
-		if ri.len() == 1 {
-			b.root = ri.pointers[0]
-			b.height--
+// Select returns the i-th smallest key (0-indexed) and its value, or nil for both if i is out of range.
+func (b *BTree[V]) Select(i int) (Bytes, *V) {
+	if i < 0 || i >= b.count {
+		return nil, nil
+	}
+
+	n := b.root
+	for !n.isLeaf() {
+		ni := n.(*InternalNode[*V])
+		ci := 0
+		for int64(i) >= ni.counts[ci] {
+			i -= int(ni.counts[ci])
+			ci++
 		}
+		n = ni.pointers[ci]
 	}
-	return del
+	return n.(*LeafNode[*V]).pairAt(i)
 }
 
-func (b *BTree[V]) baseIterator(low, high Bytes) iter.Seq2[Bytes, *V] {
-	return func(yield func(Bytes, *V) bool) {
-		// get reference to key that is equal to `low` or minimally larger than it
-		leaf, _ := leafAndPathForKey(b.root, low, nil)
-		idx, _ := lowerBoundBytesArr(leaf.keys, low)
-		if leaf == nil {
-			panic("leaf node not found")
-		}
+// Min returns the smallest key in the tree and its value, ok is false if the tree is empty
+func (b *BTree[V]) Min() (key Bytes, value *V, ok bool) {
+	c := b.Cursor()
+	return cursorPair(c, c.First())
+}
 
-		for idx < len(leaf.keys) && (high == nil || bytes.Compare(leaf.keys[idx], high) < 0) {
-			k, v := leaf.pairAt(idx)
-			if !yield(k, v) {
-				break
-			}
-			idx++
-			if idx >= len(leaf.keys) {
-				leaf = leaf.next
-				if leaf == nil {
-					break
-				}
-				idx = 0
-			}
-		}
+// Max returns the largest key in the tree and its value, ok is false if the tree is empty
+func (b *BTree[V]) Max() (key Bytes, value *V, ok bool) {
+	c := b.Cursor()
+	return cursorPair(c, c.Last())
+}
+
+// Floor returns the largest key that is smaller than or equal to key
+func (b *BTree[V]) Floor(key Bytes) (Bytes, *V, bool) {
+	c := b.Cursor()
+	return cursorPair(c, c.seekFloor(key))
+}
+
+// Ceiling returns the smallest key that is larger than or equal to key
+func (b *BTree[V]) Ceiling(key Bytes) (Bytes, *V, bool) {
+	c := b.Cursor()
+	return cursorPair(c, c.Seek(key))
+}
+
+// Lower returns the largest key that is strictly smaller than key
+func (b *BTree[V]) Lower(key Bytes) (Bytes, *V, bool) {
+	c := b.Cursor()
+	return cursorPair(c, c.SeekBefore(key))
+}
+
+// Higher returns the smallest key that is strictly larger than key
+func (b *BTree[V]) Higher(key Bytes) (Bytes, *V, bool) {
+	c := b.Cursor()
+	return cursorPair(c, c.seekAfter(key))
+}
+
+func cursorPair[V any](c *Cursor[V], ok bool) (Bytes, *V, bool) {
+	if !ok {
+		return nil, nil, false
 	}
+	return c.Key(), c.Value(), true
+}
+
+func (b *BTree[V]) baseIterator(low, high Bytes) iter.Seq2[Bytes, *V] {
+	return b.RangeBounds(nilBounds(low, high))
 }
 
 func (b *BTree[V]) All() iter.Seq2[Bytes, *V] {
@@ -93,3 +192,16 @@ func (b *BTree[V]) All() iter.Seq2[Bytes, *V] {
 func (b *BTree[V]) Range(low, high Bytes) iter.Seq2[Bytes, *V] {
 	return b.baseIterator(low, high)
 }
+
+// Prefix iterates over the pairs with keys that start with p in ascending order, an empty p matches all
+// keys. It relies on keys with a common prefix being contiguous and ordered as bytes, as with the default
+// comparator.
+func (b *BTree[V]) Prefix(p Bytes) iter.Seq2[Bytes, *V] {
+	return b.baseIterator(p, PrefixEnd(p))
+}
+
+// Backward iterates over the pairs with keys in [low, high) in descending order.
+// A nil high means there is no upper bound.
+func (b *BTree[V]) Backward(low, high Bytes) iter.Seq2[Bytes, *V] {
+	return b.BackwardBounds(nilBounds(low, high))
+}
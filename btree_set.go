@@ -0,0 +1,184 @@
+package btree
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+)
+
+// BTreeSet is a B+ tree of keys without values, for indexes that only need membership. The values of its
+// leaves are zero-sized, so unlike the slice of pointers of a BTree with *struct{} values, their slices
+// never allocate. The leaves still have the header of the slice, so that sets share the code of the
+// leaves of the other trees.
+type BTreeSet struct {
+	treeCore[struct{}]
+}
+
+// NewBTreeSet returns an empty set, or ErrInvalidDegree if the degree is less than 3
+func NewBTreeSet(degree int, expectedHeight int) (*BTreeSet, error) {
+	if degree < 3 {
+		return nil, fmt.Errorf("%w, got %d", ErrInvalidDegree, degree)
+	}
+	return &BTreeSet{newTreeCore[struct{}](degree, max(expectedHeight, 0), nil)}, nil
+}
+
+func (s *BTreeSet) Degree() int {
+	return s.deg
+}
+
+// Len returns the number of keys in the set in O(1) time
+func (s *BTreeSet) Len() int {
+	return s.count
+}
+
+// Contains returns whether key is in the set
+func (s *BTreeSet) Contains(key Bytes) bool {
+	_, ok := lookup(s.root, key)
+	return ok
+}
+
+// Add inserts key into the set and returns whether it wasn't there already.
+// It returns ErrCorrupt if the tree breaks its invariants.
+func (s *BTreeSet) Add(key Bytes) (bool, error) {
+	count := s.count
+	err := s.finishInsert(setOrInsert(s.mutableRoot(), key, struct{}{}, s.stack))
+	return s.count > count, err
+}
+
+// Remove deletes key from the set and returns whether it was there.
+// It returns ErrCorrupt if the tree breaks its invariants.
+func (s *BTreeSet) Remove(key Bytes) (bool, error) {
+	return s.finishDelete(deleteFromNode(s.mutableRoot(), key, s.stack))
+}
+
+// Clone returns a copy of the set in O(1) time, see BTree.Clone
+func (s *BTreeSet) Clone() *BTreeSet {
+	return &BTreeSet{s.clone()}
+}
+
+// Validate checks the invariants of the tree, see BTree.Validate
+func (s *BTreeSet) Validate() error {
+	return s.validate()
+}
+
+func (s *BTreeSet) All() iter.Seq[Bytes] {
+	return s.Range(nil, nil)
+}
+
+// Range iterates over the keys in [low, high) in ascending order, nil bounds are unbounded
+func (s *BTreeSet) Range(low, high Bytes) iter.Seq[Bytes] {
+	return s.RangeBounds(nilBounds(low, high))
+}
+
+// Backward iterates over the keys in [low, high) in descending order, nil bounds are unbounded
+func (s *BTreeSet) Backward(low, high Bytes) iter.Seq[Bytes] {
+	return s.BackwardBounds(nilBounds(low, high))
+}
+
+// RangeBounds iterates over the keys between lo and hi in ascending order
+func (s *BTreeSet) RangeBounds(lo, hi Bounds) iter.Seq[Bytes] {
+	return setKeys(rangeBounds(&s.treeCore, lo, hi))
+}
+
+// BackwardBounds iterates over the keys between lo and hi in descending order
+func (s *BTreeSet) BackwardBounds(lo, hi Bounds) iter.Seq[Bytes] {
+	return setKeys(backwardBounds(&s.treeCore, lo, hi))
+}
+
+// setKeys drops the values of the pairs of seq
+func setKeys(seq iter.Seq2[Bytes, struct{}]) iter.Seq[Bytes] {
+	return func(yield func(Bytes) bool) {
+		for k := range seq {
+			if !yield(k) {
+				return
+			}
+		}
+	}
+}
+
+// Union returns a new set with the keys that are in s or in other, with the degree of s.
+// It returns ErrCorrupt if either set breaks its invariants.
+func (s *BTreeSet) Union(other *BTreeSet) (*BTreeSet, error) {
+	return s.merge(other, func(inS, inOther bool) bool { return inS || inOther })
+}
+
+// Intersect returns a new set with the keys that are in both s and other, with the degree of s.
+// It returns ErrCorrupt if either set breaks its invariants.
+func (s *BTreeSet) Intersect(other *BTreeSet) (*BTreeSet, error) {
+	return s.merge(other, func(inS, inOther bool) bool { return inS && inOther })
+}
+
+// Difference returns a new set with the keys that are in s but not in other, with the degree of s.
+// It returns ErrCorrupt if either set breaks its invariants.
+func (s *BTreeSet) Difference(other *BTreeSet) (*BTreeSet, error) {
+	return s.merge(other, func(inS, inOther bool) bool { return inS && !inOther })
+}
+
+// merge walks both sets side by side with cursors in O(len(s) + len(other)) time and builds a new set
+// bottom-up from the keys for which keep returns true, see BuildFromSorted. The new set shares its keys
+// with s and other.
+func (s *BTreeSet) merge(other *BTreeSet, keep func(inS, inOther bool) bool) (*BTreeSet, error) {
+	res := &BTreeSet{newTreeCore[struct{}](s.deg, s.height+1, nil)}
+	if err := res.build(mergeKeys(&s.treeCore, &other.treeCore, keep), 1); err != nil {
+		// the merged keys are only out of order if the keys of a set are
+		if errors.Is(err, ErrUnsortedInput) {
+			err = fmt.Errorf("%w: %w", ErrCorrupt, err)
+		}
+		return nil, err
+	}
+	return res, nil
+}
+
+// mergeKeys yields the keys of the trees a and b in ascending order, once each, for which keep returns
+// true given whether the key is in a and whether it is in b
+func mergeKeys[E any](a, b *treeCore[E], keep func(inA, inB bool) bool) iter.Seq2[Bytes, E] {
+	return func(yield func(Bytes, E) bool) {
+		ca, cb := newCursor(a), newCursor(b)
+		okA, okB := ca.First(), cb.First()
+		var ka, kb Bytes
+		if okA {
+			ka = ca.Key()
+		}
+		if okB {
+			kb = cb.Key()
+		}
+
+		for {
+			// the rest of a single tree is skipped if none of its keys can be kept
+			if !okA && (!okB || !keep(false, true)) || !okB && !keep(true, false) {
+				return
+			}
+
+			c := 0
+			switch {
+			case !okB:
+				c = -1
+			case !okA:
+				c = 1
+			default:
+				c = a.ctx.compare(ka, kb)
+			}
+
+			var k Bytes
+			var v E
+			inA, inB := c <= 0, c >= 0
+			if inA {
+				k, v = ka, ca.value()
+				if okA = ca.Next(); okA {
+					ka = ca.Key()
+				}
+			}
+			if inB {
+				if !inA {
+					k, v = kb, cb.value()
+				}
+				if okB = cb.Next(); okB {
+					kb = cb.Key()
+				}
+			}
+			if keep(inA, inB) && !yield(k, v) {
+				return
+			}
+		}
+	}
+}
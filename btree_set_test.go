@@ -0,0 +1,146 @@
+package btree
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// randomSet returns a set and a map with the same random subset of keys
+func randomSet(t *testing.T, degree int, keys []Hash, n int) (*BTreeSet, map[Hash]bool) {
+	s := must[*BTreeSet](t)(NewBTreeSet(degree, 4))
+	want := map[Hash]bool{}
+	for range n {
+		k := keys[rand.Intn(len(keys))]
+		added, err := s.Add(k[:])
+		if err != nil || added == want[k] {
+			t.Fatalf("Add returned %v %v, key existed: %v", added, err, want[k])
+		}
+		want[k] = true
+	}
+	return s, want
+}
+
+// checkSet checks that s is valid and holds exactly the keys of want, in order
+func checkSet(t *testing.T, s *BTreeSet, want map[Hash]bool) {
+	t.Helper()
+	if err := s.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if s.Len() != len(want) {
+		t.Fatalf("Len is %d, expected %d", s.Len(), len(want))
+	}
+	var exp []Bytes
+	for k := range want {
+		exp = append(exp, Bytes(k[:]))
+	}
+	slices.SortFunc(exp, bytes.Compare)
+	if got := slices.Collect(s.All()); !slices.EqualFunc(got, exp, bytes.Equal) {
+		t.Fatalf("All returned %d keys, expected %d", len(got), len(exp))
+	}
+}
+
+func TestBTreeSetAlgebra(t *testing.T) {
+	keys, _ := GetData(2000)
+	for _, degrees := range [][2]int{{3, 3}, {4, 9}, {16, 5}} {
+		a, inA := randomSet(t, degrees[0], keys, 1500)
+		b, inB := randomSet(t, degrees[1], keys, 1000)
+		empty, m := must[*BTreeSet](t)(NewBTreeSet(4, 4)), must[*BTreeSet](t)
+
+		union, inter, diff := map[Hash]bool{}, map[Hash]bool{}, map[Hash]bool{}
+		for k := range inA {
+			union[k] = true
+			if inB[k] {
+				inter[k] = true
+			} else {
+				diff[k] = true
+			}
+		}
+		for k := range inB {
+			union[k] = true
+		}
+
+		checkSet(t, m(a.Union(b)), union)
+		checkSet(t, m(b.Union(a)), union)
+		checkSet(t, m(a.Intersect(b)), inter)
+		checkSet(t, m(b.Intersect(a)), inter)
+		checkSet(t, m(a.Difference(b)), diff)
+		checkSet(t, m(a.Difference(a)), nil)
+		checkSet(t, m(a.Union(empty)), inA)
+		checkSet(t, m(empty.Union(a)), inA)
+		checkSet(t, m(a.Intersect(empty)), nil)
+		checkSet(t, m(empty.Difference(a)), nil)
+
+		if got := m(a.Union(b)).Degree(); got != degrees[0] {
+			t.Fatalf("Union has degree %d, expected %d", got, degrees[0])
+		}
+		// the operands are left as they were
+		checkSet(t, a, inA)
+		checkSet(t, b, inB)
+	}
+}
+
+// Sets built by merges and clones must be independent of their sources
+func TestBTreeSetClone(t *testing.T) {
+	keys, _ := GetData(1000)
+	a, inA := randomSet(t, 4, keys, 800)
+	b, inB := randomSet(t, 4, keys, 800)
+	c := a.Clone()
+	u := must[*BTreeSet](t)(a.Union(b))
+
+	for _, k := range keys[:500] {
+		if _, err := a.Remove(k[:]); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := u.Add(k[:]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	checkSet(t, c, inA)
+	checkSet(t, b, inB)
+
+	want := map[Hash]bool{}
+	for k := range inA {
+		want[k] = true
+	}
+	for _, k := range keys[:500] {
+		delete(want, k)
+	}
+	checkSet(t, a, want)
+	// merging with a clone that shares nodes
+	checkSet(t, must[*BTreeSet](t)(c.Difference(a)), func() map[Hash]bool {
+		d := map[Hash]bool{}
+		for _, k := range keys[:500] {
+			if inA[k] {
+				d[k] = true
+			}
+		}
+		return d
+	}())
+}
+
+func TestNewBTreeSetValidatesDegree(t *testing.T) {
+	for _, deg := range []int{-1, 0, 1, 2} {
+		if _, err := NewBTreeSet(deg, 0); !errors.Is(err, ErrInvalidDegree) {
+			t.Errorf("degree %d: got error %v", deg, err)
+		}
+	}
+}
+
+// Set operations on a corrupted set must return ErrCorrupt instead of panicking
+func TestBTreeSetAlgebraReportsCorruption(t *testing.T) {
+	s, other := must[*BTreeSet](t)(NewBTreeSet(8, 4)), must[*BTreeSet](t)(NewBTreeSet(8, 4))
+	for _, k := range []string{"a", "b", "c"} {
+		if _, err := s.Add(Bytes(k)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l := s.root.(*LeafNode[struct{}])
+	l.keys[0], l.keys[1] = l.keys[1], l.keys[0]
+
+	if _, err := s.Union(other); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("expected ErrCorrupt, got %v", err)
+	}
+}
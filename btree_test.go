@@ -0,0 +1,312 @@
+package btree
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// Rank of every inserted key must be its index in sorted order, and Select must invert it
+func TestTreeRankSelect(t *testing.T) {
+	m, goMap, keys := buildComparableMaps(3000, 4)
+
+	for i, key := range keys {
+		if r := m.Rank(key[:]); r != i {
+			t.Fatalf("rank of key %d: got %d", i, r)
+		}
+
+		k, v := m.Select(i)
+		if !bytes.Equal(k, key[:]) {
+			t.Fatalf("select %d: got key %s, want %s", i, k, key)
+		}
+		if v == nil || *v != goMap[key] {
+			t.Fatalf("select %d: wrong value", i)
+		}
+	}
+
+	if k, v := m.Select(len(keys)); k != nil || v != nil {
+		t.Errorf("out of range select returned a pair")
+	}
+	if k, v := m.Select(-1); k != nil || v != nil {
+		t.Errorf("negative select returned a pair")
+	}
+	if r := m.Rank(nil); r != 0 {
+		t.Errorf("rank of nil key: got %d, want 0", r)
+	}
+	if r := m.Rank(bytes.Repeat([]byte{0xff}, 33)); r != len(keys) {
+		t.Errorf("rank of max key: got %d, want %d", r, len(keys))
+	}
+}
+
+// Counts must stay correct through updates, rebalancing and merges
+func TestTreeRankSelectAfterDelete(t *testing.T) {
+	const nKeys = 2000
+	m, _, keys := buildComparableMaps(nKeys, 5)
+
+	// updates of existing keys must not change counts
+	for _, key := range keys[:100] {
+		v := rand.Int()
+		m.Set(key, &v)
+	}
+
+	perm := rand.Perm(nKeys)
+	deleted := make([]bool, nKeys)
+	for i, p := range perm[:nKeys*3/4] {
+		m.Del(keys[p])
+		deleted[p] = true
+		runMapHealthTests(t, m, nKeys-i-1, true)
+	}
+
+	remaining := 0
+	for i, key := range keys {
+		if deleted[i] {
+			continue
+		}
+		if r := m.Rank(key[:]); r != remaining {
+			t.Fatalf("rank after delete: got %d, want %d", r, remaining)
+		}
+		if k, _ := m.Select(remaining); !bytes.Equal(k, key[:]) {
+			t.Fatalf("select after delete: got %s, want %s", k, key)
+		}
+		remaining++
+	}
+}
+
+func TestNewValidatesOptions(t *testing.T) {
+	for _, deg := range []int{-1, 0, 1, 2} {
+		if _, err := New(Options[int]{Degree: deg}); !errors.Is(err, ErrInvalidDegree) {
+			t.Errorf("degree %d: got error %v", deg, err)
+		}
+	}
+
+	if _, err := New(Options[int]{Degree: 3, Compare: ReverseOrder(nil), CompressKeys: true}); err == nil {
+		t.Errorf("CompressKeys accepted with a comparator")
+	}
+
+	b, err := New(Options[int]{Degree: 3, Compare: ReverseOrder(nil)})
+	if err != nil {
+		t.Fatalf("valid options rejected: %v", err)
+	}
+	for i := range 100 {
+		b.SetOp(Bytes{byte(i)}, &i)
+	}
+	if k, _ := b.Select(0); !bytes.Equal(k, Bytes{99}) {
+		t.Errorf("comparator not used, smallest key is %v", k)
+	}
+}
+
+// Mutations of a corrupted tree must return ErrCorrupt instead of panicking
+func TestMutationsReportCorruption(t *testing.T) {
+	keys, values := GetData(500)
+	sorted := slices.Clone(keys)
+	slices.SortFunc(sorted, func(a, b Hash) int { return bytes.Compare(a[:], b[:]) })
+
+	b := NewBTree[int](3, 4)
+	for i := range keys {
+		b.SetOp(keys[i][:], &values[i])
+	}
+	root := b.root.(*InternalNode[*int])
+
+	// missing counts are detected on insertion
+	counts := root.counts
+	root.counts = root.counts[:1]
+	if err := b.SetOp(keys[0][:], &values[0]); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("insertion into node without counts: got %v", err)
+	}
+	// and on deletion
+	if _, err := b.DelOp(sorted[len(sorted)-1][:]); !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("deletion from node without counts: got %v", err)
+	}
+	root.counts = counts
+
+	// a leaf next to an internal node can't be rebalanced with it
+	leaf := newLeafNode[*int](2)
+	leaf.ctx = root.ctx
+	root.pointers[1], root.counts[1] = leaf, 0
+	var err error
+	for _, k := range sorted {
+		if _, err = b.DelOp(k[:]); err != nil {
+			break
+		}
+	}
+	if !errors.Is(err, ErrCorrupt) {
+		t.Fatalf("rebalancing with a node of another type: got %v", err)
+	}
+}
+
+// Len must count insertions but not updates, and deletions of existing keys only
+func TestTreeLen(t *testing.T) {
+	m := NewMap[Hash, int](4, func(s Hash) Hash { return s }, 4)
+	keys, values := GetData(2000)
+	want := map[Hash]bool{}
+	for range 10000 {
+		i := rand.Intn(len(keys))
+		if rand.Intn(3) == 0 {
+			m.Del(keys[i])
+			delete(want, keys[i])
+		} else {
+			m.Set(keys[i], &values[i])
+			want[keys[i]] = true
+		}
+		if m.Len() != len(want) {
+			t.Fatalf("Len is %d, expected %d", m.Len(), len(want))
+		}
+	}
+
+	c := m.Clone()
+	for k := range want {
+		c.DelOp(k[:])
+	}
+	if c.Len() != 0 || m.Len() != len(want) {
+		t.Fatalf("Len of clone %d and original %d", c.Len(), m.Len())
+	}
+
+	b, _ := BuildFromSorted(5, sortedPairs(sortedTestKeys(777)), 0.8)
+	if b.Len() != 777 {
+		t.Fatalf("Len of bulk loaded tree is %d", b.Len())
+	}
+}
+
+// Neighbor lookups must agree with a binary search on the sorted keys, for present and absent keys
+func TestTreeNeighbors(t *testing.T) {
+	b := NewBTree[int](4, 4)
+	if _, _, ok := b.Min(); ok {
+		t.Fatalf("min of empty tree")
+	}
+	if _, _, ok := b.Floor(Bytes("x")); ok {
+		t.Fatalf("floor in empty tree")
+	}
+
+	var keys []Bytes
+	for i := range 500 {
+		k := Bytes{byte(i / 100), byte(i%100) * 2} // only even second bytes
+		v := i
+		b.SetOp(k, &v)
+		keys = append(keys, k)
+	}
+
+	check := func(name string, q Bytes, got Bytes, ok bool, idx int) {
+		t.Helper()
+		if idx < 0 || idx >= len(keys) {
+			if ok {
+				t.Fatalf("%s(%v): got %v, want none", name, q, got)
+			}
+			return
+		}
+		if !ok || !bytes.Equal(got, keys[idx]) {
+			t.Fatalf("%s(%v): got %v %v, want %v", name, q, got, ok, keys[idx])
+		}
+	}
+
+	for hi := range 6 {
+		for lo := range 201 {
+			q := Bytes{byte(hi), byte(lo)}
+			i, found := slices.BinarySearchFunc(keys, q, bytes.Compare)
+			k, v, ok := b.Ceiling(q)
+			check("Ceiling", q, k, ok, i)
+			if ok && *v != i {
+				t.Fatalf("wrong value for %v", k)
+			}
+			k, _, ok = b.Lower(q)
+			check("Lower", q, k, ok, i-1)
+			if found {
+				k, _, ok = b.Floor(q)
+				check("Floor", q, k, ok, i)
+				k, _, ok = b.Higher(q)
+				check("Higher", q, k, ok, i+1)
+			} else {
+				k, _, ok = b.Floor(q)
+				check("Floor", q, k, ok, i-1)
+				k, _, ok = b.Higher(q)
+				check("Higher", q, k, ok, i)
+			}
+		}
+	}
+
+	k, v, ok := b.Min()
+	if !ok || !bytes.Equal(k, keys[0]) || *v != 0 {
+		t.Errorf("min: got %v", k)
+	}
+	k, v, ok = b.Max()
+	if !ok || !bytes.Equal(k, keys[len(keys)-1]) || *v != len(keys)-1 {
+		t.Errorf("max: got %v", k)
+	}
+}
+
+func TestPrefixEnd(t *testing.T) {
+	tests := []struct{ p, want Bytes }{
+		{nil, nil},
+		{Bytes{}, nil},
+		{Bytes("a"), Bytes("b")},
+		{Bytes{1, 0xff}, Bytes{2}},
+		{Bytes{1, 0xfe, 0xff, 0xff}, Bytes{1, 0xff}},
+		{Bytes{0xff, 0xff}, nil},
+	}
+	for _, tt := range tests {
+		if got := PrefixEnd(tt.p); !bytes.Equal(got, tt.want) || (got == nil) != (tt.want == nil) {
+			t.Errorf("PrefixEnd(%v) = %v, want %v", tt.p, got, tt.want)
+		}
+	}
+
+	p := Bytes{1, 0xff}
+	PrefixEnd(p)
+	if !bytes.Equal(p, Bytes{1, 0xff}) {
+		t.Errorf("PrefixEnd modified its argument")
+	}
+}
+
+// Prefix must yield exactly the keys starting with the prefix, including around 0xFF bytes
+func TestTreePrefix(t *testing.T) {
+	b := NewBTree[int](4, 4)
+	var keys []Bytes
+	for _, a := range []byte{0, 1, 0xfe, 0xff} {
+		for _, c := range []byte{0, 0x7f, 0xff} {
+			for _, d := range []byte{0, 0xff} {
+				keys = append(keys, Bytes{a, c}, Bytes{a, c, d})
+			}
+		}
+		keys = append(keys, Bytes{a})
+	}
+	for i, k := range keys {
+		b.SetOp(k, &i)
+	}
+
+	for _, p := range []Bytes{nil, {}, {0}, {1}, {0xfe}, {0xff}, {0xff, 0xff}, {0xfe, 0xff}, {0xff, 0x7f, 0}, {2}, {0xff, 0xff, 0xff, 0xff}} {
+		var want []Bytes
+		for _, k := range keys {
+			if bytes.HasPrefix(k, p) && !slices.ContainsFunc(want, func(w Bytes) bool { return bytes.Equal(w, k) }) {
+				want = append(want, k)
+			}
+		}
+		slices.SortFunc(want, bytes.Compare)
+
+		var got []Bytes
+		for k := range b.Prefix(p) {
+			got = append(got, k)
+		}
+		if !slices.EqualFunc(got, want, bytes.Equal) {
+			t.Errorf("Prefix(%v) = %v, want %v", p, got, want)
+		}
+	}
+}
+
+// NewBTree raises degrees that are too small instead of building a tree that can't split its nodes
+func TestNewBTreeSmallDegree(t *testing.T) {
+	for _, deg := range []int{-1, 0, 1, 2} {
+		b := NewBTree[int](deg, -1)
+		if b.Degree() != 3 {
+			t.Fatalf("degree %d was changed to %d", deg, b.Degree())
+		}
+		keys, values := GetData(100)
+		for i := range keys {
+			if err := b.SetOp(keys[i][:], &values[i]); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := b.Validate(); err != nil || b.Len() != len(keys) {
+			t.Fatalf("degree %d: Len %d, %v", deg, b.Len(), err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package btree
+
+import "container/list"
+
+type frame struct {
+	id    pageID
+	data  []byte
+	dirty bool
+}
+
+// bufferPool caches up to `capacity` pages of a pager in memory, evicting the least recently used page
+// when full. Dirty pages are written back on eviction or flush.
+type bufferPool struct {
+	pager    *pager
+	capacity int
+	frames   map[pageID]*list.Element // values of the list elements are *frame
+	lru      *list.List               // front is the most recently used frame
+}
+
+func newBufferPool(p *pager, capacity int) *bufferPool {
+	return &bufferPool{
+		pager:    p,
+		capacity: capacity,
+		frames:   make(map[pageID]*list.Element, capacity),
+		lru:      list.New(),
+	}
+}
+
+// fetch returns the contents of the page. The returned slice is owned by the pool and is only valid
+// until the next call on the pool, callers must copy whatever they need to keep.
+func (bp *bufferPool) fetch(id pageID) ([]byte, error) {
+	if e, ok := bp.frames[id]; ok {
+		bp.lru.MoveToFront(e)
+		return e.Value.(*frame).data, nil
+	}
+
+	f, err := bp.newFrame(id)
+	if err != nil {
+		return nil, err
+	}
+	if err := bp.pager.readPage(id, f.data); err != nil {
+		bp.drop(id)
+		return nil, err
+	}
+	return f.data, nil
+}
+
+// update replaces the contents of the page with data and marks it dirty
+func (bp *bufferPool) update(id pageID, data []byte) error {
+	var f *frame
+	if e, ok := bp.frames[id]; ok {
+		bp.lru.MoveToFront(e)
+		f = e.Value.(*frame)
+	} else {
+		var err error
+		if f, err = bp.newFrame(id); err != nil {
+			return err
+		}
+	}
+
+	copy(f.data, data)
+	clear(f.data[len(data):])
+	f.dirty = true
+	return nil
+}
+
+// newFrame adds an empty frame for the page to the pool, evicting another page if the pool is full
+func (bp *bufferPool) newFrame(id pageID) (*frame, error) {
+	var f *frame
+	if bp.lru.Len() >= bp.capacity {
+		// reuse the buffer of the evicted frame
+		e := bp.lru.Back()
+		f = e.Value.(*frame)
+		if err := bp.writeBack(f); err != nil {
+			return nil, err
+		}
+		bp.lru.Remove(e)
+		delete(bp.frames, f.id)
+		f.id = id
+	} else {
+		f = &frame{id: id, data: make([]byte, bp.pager.pageSize)}
+	}
+
+	bp.frames[id] = bp.lru.PushFront(f)
+	return f, nil
+}
+
+func (bp *bufferPool) drop(id pageID) {
+	if e, ok := bp.frames[id]; ok {
+		bp.lru.Remove(e)
+		delete(bp.frames, id)
+	}
+}
+
+func (bp *bufferPool) writeBack(f *frame) error {
+	if !f.dirty {
+		return nil
+	}
+	if err := bp.pager.writePage(f.id, f.data); err != nil {
+		return err
+	}
+	f.dirty = false
+	return nil
+}
+
+// flush writes all dirty pages to the pager and syncs the underlying file. The meta page is written
+// and synced last, so that it doesn't reach the file before the pages it points to when flush
+// completes. Pages written back on eviction aren't ordered this way, see DiskBTree.
+func (bp *bufferPool) flush() error {
+	for e := bp.lru.Back(); e != nil; e = e.Prev() {
+		if f := e.Value.(*frame); f.id != metaPageID {
+			if err := bp.writeBack(f); err != nil {
+				return err
+			}
+		}
+	}
+	if err := bp.pager.sync(); err != nil {
+		return err
+	}
+	if e, ok := bp.frames[metaPageID]; ok && e.Value.(*frame).dirty {
+		if err := bp.writeBack(e.Value.(*frame)); err != nil {
+			return err
+		}
+		return bp.pager.sync()
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package btree
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"math"
+)
+
+var ErrUnsortedInput = errors.New("btree: keys are not in strictly increasing order")
+
+// BuildFromSorted builds a tree from pairs sorted by key in strictly increasing order, without the
+// repeated descents and half-full splits of inserting them one by one.
+// Leaves are filled left to right with fillFactor of their capacity (but never less than the minimum), and
+// the internal levels are built bottom-up the same way. A fillFactor of 1 gives the most compact tree,
+// lower values leave space for later inserts.
+func BuildFromSorted[V any](degree int, seq iter.Seq2[Bytes, *V], fillFactor float64) (*BTree[V], error) {
+	return buildFromSorted(degree, seq, fillFactor, nil)
+}
+
+// BuildFromSortedFunc is BuildFromSorted for trees that order keys with cmp, see NewBTreeFunc
+func BuildFromSortedFunc[V any](degree int, seq iter.Seq2[Bytes, *V], fillFactor float64, cmp Comparator) (*BTree[V], error) {
+	return buildFromSorted(degree, seq, fillFactor, &treeContext{cmp: cmp})
+}
+
+func buildFromSorted[V any](degree int, seq iter.Seq2[Bytes, *V], fillFactor float64, ctx *treeContext) (*BTree[V], error) {
+	if degree < 3 {
+		return nil, fmt.Errorf("%w, got %d", ErrInvalidDegree, degree)
+	}
+	if !(fillFactor > 0 && fillFactor <= 1) {
+		return nil, fmt.Errorf("btree: fill factor must be in (0, 1], got %v", fillFactor)
+	}
+
+	b := newBTree[V](degree, 0, ctx)
+	if err := b.build(seq, fillFactor); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// build fills the empty tree with the pairs of seq, see BuildFromSorted
+func (b *treeCore[E]) build(seq iter.Seq2[Bytes, E], fillFactor float64) error {
+	leaves, err := buildLeaves(b.root.(*LeafNode[E]), seq, fillFactor)
+	if err != nil {
+		return err
+	}
+	if leaves[0].len() == 0 {
+		return nil
+	}
+
+	level := make([]Node[E], len(leaves))
+	for i, l := range leaves {
+		level[i] = l
+	}
+	// seps[i] is the smallest key in the subtree of level[i]
+	seps := make([]Bytes, len(leaves))
+	for i, l := range leaves {
+		seps[i] = l.keys[0]
+	}
+
+	ptrFill := fill(b.deg, ceilDiv(b.deg, 2), fillFactor)
+	for len(level) > 1 {
+		level, seps, err = buildInternalLevel(b.deg, level, seps, ptrFill)
+		if err != nil {
+			return err
+		}
+		b.height++
+	}
+
+	b.root = level[0]
+	b.count = b.root.size()
+	b.stack = NewStack[TraversalPositions[E]](b.height + 1)
+	return nil
+}
+
+// fill returns the number of entries to put in a node with the given capacity and minimum
+func fill(capacity, minimum int, fillFactor float64) int {
+	n := int(math.Round(float64(capacity) * fillFactor))
+	return max(minimum, min(capacity, n))
+}
+
+// buildLeaves fills first and then as many new leaves as needed with the pairs of seq, linking them in order
+func buildLeaves[V any](first *LeafNode[V], seq iter.Seq2[Bytes, V], fillFactor float64) ([]*LeafNode[V], error) {
+	leafFill := fill(cap(first.keys), first.minCount, fillFactor)
+	leaves := []*LeafNode[V]{first}
+	l := first
+	var prev Bytes
+
+	count := 0
+	for k, v := range seq {
+		if count > 0 && first.ctx.compare(prev, k) >= 0 {
+			return nil, fmt.Errorf("%w: %q after %q", ErrUnsortedInput, k, prev)
+		}
+		prev = k
+		count++
+
+		if l.len() == leafFill {
+			r := newLeafNode[V](cap(l.keys))
+			r.ctx = l.ctx
+			l.next, r.prev = r, l
+			leaves = append(leaves, r)
+			l = r
+		}
+		l.keys = append(l.keys, k)
+		l.values = append(l.values, v)
+	}
+
+	// the last leaf can have less than the minimum number of keys
+	if n := len(leaves); n > 1 && l.needsRebalance() {
+		upKey, err := leaves[n-2].rebalanceWith(l, nil)
+		if err != nil {
+			return nil, err
+		}
+		if upKey == nil {
+			leaves = leaves[:n-1]
+		}
+	}
+	return leaves, nil
+}
+
+// buildInternalLevel groups the nodes of a level under new internal nodes, and returns the new level
+// along with the smallest key under each of its nodes
+func buildInternalLevel[V any](degree int, level []Node[V], seps []Bytes, ptrFill int) ([]Node[V], []Bytes, error) {
+	var parents []Node[V]
+	var parentSeps []Bytes
+
+	for start := 0; start < len(level); start += ptrFill {
+		end := min(start+ptrFill, len(level))
+		n := newInternalNode[V](degree)
+		n.ctx = level[start].context()
+		for i := start; i < end; i++ {
+			if i > start {
+				n.keys = append(n.keys, seps[i])
+			}
+			n.pointers = append(n.pointers, level[i])
+			n.counts = append(n.counts, int64(level[i].size()))
+		}
+		n.encodeKeys()
+		parents = append(parents, n)
+		parentSeps = append(parentSeps, seps[start])
+	}
+
+	// the last node can have less than the minimum number of pointers
+	if n := len(parents); n > 1 && parents[n-1].needsRebalance() {
+		upKey, err := parents[n-2].rebalanceWith(parents[n-1], parentSeps[n-1])
+		if err != nil {
+			return nil, nil, err
+		}
+		if upKey == nil {
+			parents, parentSeps = parents[:n-1], parentSeps[:n-1]
+		} else {
+			parentSeps[n-1] = upKey
+		}
+	}
+	return parents, parentSeps, nil
+}
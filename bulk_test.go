@@ -0,0 +1,123 @@
+package btree
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"iter"
+	"slices"
+	"testing"
+)
+
+func sortedPairs(keys []Bytes) iter.Seq2[Bytes, *int] {
+	return func(yield func(Bytes, *int) bool) {
+		for i, k := range keys {
+			v := i
+			if !yield(k, &v) {
+				return
+			}
+		}
+	}
+}
+
+func sortedTestKeys(n int) []Bytes {
+	keys := make([]Bytes, n)
+	for i := range keys {
+		keys[i] = Bytes(fmt.Sprintf("%08d", i))
+	}
+	return keys
+}
+
+// leafDepths returns the depth of every leaf under n
+func leafDepths[V any](n Node[V], depth int, depths []int) []int {
+	if n.isLeaf() {
+		return append(depths, depth)
+	}
+	for _, p := range n.(*InternalNode[V]).pointers {
+		depths = leafDepths(p, depth+1, depths)
+	}
+	return depths
+}
+
+func TestBuildFromSorted(t *testing.T) {
+	for _, deg := range []int{3, 4, 9} {
+		for _, n := range []int{0, 1, deg - 1, deg, 1000} {
+			for _, ff := range []float64{0.01, 0.7, 1} {
+				keys := sortedTestKeys(n)
+				b, err := BuildFromSorted(deg, sortedPairs(keys), ff)
+				if err != nil {
+					t.Fatalf("deg %d, n %d, ff %v: %v", deg, n, ff, err)
+				}
+
+				if un, to := b.root.numUnhealthyChildren(); un != 0 {
+					t.Fatalf("deg %d, n %d, ff %v: unhealthy children ratio = %d/%d", deg, n, ff, un, to)
+				}
+				for _, d := range leafDepths(b.root, 0, nil) {
+					if d != b.height {
+						t.Fatalf("deg %d, n %d, ff %v: leaf at depth %d in tree of height %d", deg, n, ff, d, b.height)
+					}
+				}
+
+				var got []Bytes
+				for k, v := range b.All() {
+					if !bytes.Equal(keys[*v], k) {
+						t.Fatalf("wrong value for key %s", k)
+					}
+					got = append(got, k)
+				}
+				if slices.CompareFunc(got, keys, bytes.Compare) != 0 {
+					t.Fatalf("deg %d, n %d, ff %v: keys differ", deg, n, ff)
+				}
+				if n > 0 {
+					if k, _ := b.Select(n / 2); !bytes.Equal(k, keys[n/2]) {
+						t.Fatalf("select in bulk loaded tree returned %s", k)
+					}
+				}
+
+				// the tree must stay usable
+				for _, k := range keys {
+					if del, err := b.DelOp(k); !del || err != nil {
+						t.Fatalf("couldn't delete key %s: %v", k, err)
+					}
+				}
+				if b.height != 0 {
+					t.Fatalf("height %d after deleting all keys", b.height)
+				}
+			}
+		}
+	}
+}
+
+func TestBuildFromSortedFillFactor(t *testing.T) {
+	keys := sortedTestKeys(10000)
+	full, _ := BuildFromSorted(11, sortedPairs(keys), 1)
+	half, _ := BuildFromSorted(11, sortedPairs(keys), 0.5)
+
+	l, _ := leafAndPathForKey(full.root, nil, nil)
+	if l.len() != 10 {
+		t.Errorf("full leaves should have 10 keys, got %d", l.len())
+	}
+	l, _ = leafAndPathForKey(half.root, nil, nil)
+	if l.len() != 5 {
+		t.Errorf("half full leaves should have 5 keys, got %d", l.len())
+	}
+}
+
+func TestBuildFromSortedBadInput(t *testing.T) {
+	for _, keys := range [][]Bytes{
+		{Bytes("a"), Bytes("c"), Bytes("b")},
+		{Bytes("a"), Bytes("b"), Bytes("b")},
+		{Bytes(""), Bytes("")},
+	} {
+		if _, err := BuildFromSorted(3, sortedPairs(keys), 1); !errors.Is(err, ErrUnsortedInput) {
+			t.Errorf("keys %q: expected ErrUnsortedInput, got %v", keys, err)
+		}
+	}
+
+	if _, err := BuildFromSorted(2, sortedPairs(nil), 1); err == nil {
+		t.Errorf("expected error for degree 2")
+	}
+	if _, err := BuildFromSorted(3, sortedPairs(nil), 0); err == nil {
+		t.Errorf("expected error for fill factor 0")
+	}
+}
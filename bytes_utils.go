@@ -2,15 +2,111 @@ package btree
 
 import (
 	"bytes"
+	"cmp"
 	"fmt"
+	"slices"
+	"unicode"
+	"unicode/utf8"
 )
 
 type Bytes = []byte
 
-// Uses linear search to find the lower bound index, works better than binary search version in most cases
+// Comparator defines the order of keys in a tree. It returns a negative number if a < b, zero if a == b
+// and a positive number if a > b, like bytes.Compare, which is the default comparator.
+// Keys that compare as equal are the same key for the tree.
+// Regardless of the comparator, a nil bound in iteration methods always means that the side is unbounded.
+//
+// A comparator only changes the order of keys, which are always byte arrays. Keys of other types, such as
+// integers or structs, have to be encoded first, see OrderedMap for encodings that preserve their order.
+type Comparator func(a, b Bytes) int
+
+// ReverseOrder returns a comparator for the reverse of the order of cmp, or of bytes.Compare if cmp is nil
+func ReverseOrder(cmp Comparator) Comparator {
+	if cmp == nil {
+		cmp = bytes.Compare
+	}
+	return func(a, b Bytes) int {
+		return cmp(b, a)
+	}
+}
+
+// CompareFold is a case-insensitive comparator for UTF-8 keys, keys that differ only in case are equal.
+// Runes are compared after mapping them to a single case, and invalid UTF-8 bytes compare as utf8.RuneError.
+func CompareFold(a, b Bytes) int {
+	for len(a) > 0 && len(b) > 0 {
+		ra, na := utf8.DecodeRune(a)
+		rb, nb := utf8.DecodeRune(b)
+		if ra != rb {
+			fa, fb := unicode.ToLower(unicode.ToUpper(ra)), unicode.ToLower(unicode.ToUpper(rb))
+			if fa != fb {
+				return cmp.Compare(fa, fb)
+			}
+		}
+		a, b = a[na:], b[nb:]
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+// PrefixEnd returns the smallest key that is larger than all keys starting with p in byte order, which is
+// the exclusive upper bound of the range of keys with the prefix p. It returns nil if there is no such key,
+// when p is empty or all its bytes are 0xFF.
+func PrefixEnd(p Bytes) Bytes {
+	for i := len(p) - 1; i >= 0; i-- {
+		if p[i] != 0xff {
+			end := append(Bytes{}, p[:i+1]...)
+			end[i]++
+			return end
+		}
+	}
+	return nil
+}
+
+// commonPrefixLen returns the length of the longest common prefix of a and b
+func commonPrefixLen(a, b Bytes) int {
+	n := min(len(a), len(b))
+	for i := range n {
+		if a[i] != b[i] {
+			return i
+		}
+	}
+	return n
+}
+
 func lowerBoundBytesArr(arr []Bytes, key Bytes) (int, bool) {
+	return lowerBoundFunc(arr, key, bytes.Compare)
+}
+
+// prefixedLowerBound is lowerBoundBytesArr for keys stored in arr without the prefix they all share.
+// Keys are only compressed in byte order, where a key that doesn't start with the prefix is smaller or
+// larger than all keys in arr.
+func prefixedLowerBound(prefix Bytes, arr []Bytes, key Bytes) (int, bool) {
+	n := min(len(key), len(prefix))
+	switch c := bytes.Compare(key[:n], prefix[:n]); {
+	case c > 0:
+		return len(arr), false
+	case c < 0 || n < len(prefix):
+		return 0, false
+	}
+	return lowerBoundBytesArr(arr, key[n:])
+}
+
+// binarySearchThreshold is the number of keys above which lowerBoundFunc uses binary search. Smaller
+// nodes are faster to scan linearly, as the scan is predictable and touches few cache lines, see
+// BenchmarkLowerBound.
+const binarySearchThreshold = 8
+
+// lowerBoundFunc returns the index of the first key in arr that is greater than or equal to key, and
+// whether it's equal to key
+func lowerBoundFunc(arr []Bytes, key Bytes, compare Comparator) (int, bool) {
+	if len(arr) > binarySearchThreshold {
+		return binaryLowerBound(arr, key, compare)
+	}
+	return linearLowerBound(arr, key, compare)
+}
+
+func linearLowerBound(arr []Bytes, key Bytes, compare Comparator) (int, bool) {
 	for i := range arr {
-		cmp := bytes.Compare(arr[i], key)
+		cmp := compare(arr[i], key)
 		if cmp >= 0 {
 			return i, cmp == 0
 		}
@@ -18,6 +114,10 @@ func lowerBoundBytesArr(arr []Bytes, key Bytes) (int, bool) {
 	return len(arr), false
 }
 
+func binaryLowerBound(arr []Bytes, key Bytes, compare Comparator) (int, bool) {
+	return slices.BinarySearchFunc(arr, key, compare)
+}
+
 func printBytesArrAsStr(bs []Bytes) {
 	for _, b := range bs {
 		fmt.Println(string(b))
@@ -0,0 +1,110 @@
+package btree
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestCompareFold(t *testing.T) {
+	for _, tc := range []struct {
+		a, b string
+		want int
+	}{
+		{"abc", "ABC", 0},
+		{"Straße", "STRASSE", 1}, // no full case folding
+		{"ÄPFEL", "äpfel", 0},
+		{"apple", "Banana", -1},
+		{"APPLE", "banana", -1},
+		{"ab", "ABC", -1},
+		{"", "", 0},
+	} {
+		if got := CompareFold(Bytes(tc.a), Bytes(tc.b)); got != tc.want {
+			t.Errorf("CompareFold(%q, %q) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+		if got := CompareFold(Bytes(tc.b), Bytes(tc.a)); got != -tc.want {
+			t.Errorf("CompareFold(%q, %q) = %d, want %d", tc.b, tc.a, got, -tc.want)
+		}
+	}
+}
+
+func TestTreeCaseInsensitive(t *testing.T) {
+	b := NewBTreeFunc[int](4, 2, CompareFold)
+	words := []string{"banana", "Apple", "cherry", "Date", "elderberry", "Fig", "grape"}
+	for i, w := range words {
+		b.SetOp(Bytes(w), &i)
+	}
+
+	v := 100
+	b.SetOp(Bytes("APPLE"), &v)
+	if r := b.GetOp(Bytes("apple")); r == nil || *r != 100 {
+		t.Fatalf("case-insensitive update not found")
+	}
+
+	var got []string
+	for k := range b.All() {
+		got = append(got, string(k))
+	}
+	// the key keeps the case it was first inserted with
+	want := []string{"Apple", "banana", "cherry", "Date", "elderberry", "Fig", "grape"}
+	if !slices.Equal(got, want) {
+		t.Fatalf("got order %v, want %v", got, want)
+	}
+
+	if r := b.Rank(Bytes("CHERRY")); r != 2 {
+		t.Errorf("rank of CHERRY: got %d, want 2", r)
+	}
+	if del, _ := b.DelOp(Bytes("FIG")); !del || b.GetOp(Bytes("fig")) != nil {
+		t.Errorf("case-insensitive delete failed")
+	}
+}
+
+func TestTreeReverseOrder(t *testing.T) {
+	const n = 1000
+	b := NewBTreeFunc[int](5, 4, ReverseOrder(nil))
+	keys := make([]Bytes, n)
+	for i := range keys {
+		keys[i] = Bytes(fmt.Sprintf("%04d", i))
+		b.SetOp(keys[i], &i)
+	}
+	for i := 0; i < n; i += 3 {
+		b.DelOp(keys[i])
+	}
+	if un, to := b.root.numUnhealthyChildren(); un != 0 {
+		t.Fatalf("unhealthy children ratio = %d/%d", un, to)
+	}
+
+	var got []Bytes
+	for k := range b.All() {
+		got = append(got, k)
+	}
+	if !slices.IsSortedFunc(got, ReverseOrder(nil)) || len(got) != n-ceilDiv(n, 3) {
+		t.Fatalf("keys not in descending order")
+	}
+
+	// bounds are in the tree's order, so low is the larger key
+	var rng []Bytes
+	for k := range b.Range(Bytes("0500"), Bytes("0490")) {
+		rng = append(rng, k)
+	}
+	want := []Bytes{Bytes("0500"), Bytes("0499"), Bytes("0497"), Bytes("0496"), Bytes("0494"), Bytes("0493"), Bytes("0491")}
+	if slices.CompareFunc(rng, want, bytes.Compare) != 0 {
+		t.Fatalf("got range %q, want %q", rng, want)
+	}
+
+	var bwd []Bytes
+	for k := range b.Backward(nil, nil) {
+		bwd = append(bwd, k)
+	}
+	slices.Reverse(bwd)
+	if slices.CompareFunc(bwd, got, bytes.Compare) != 0 {
+		t.Fatalf("backward iteration isn't the reverse of forward iteration")
+	}
+
+	c := b.Clone()
+	c.SetOp(Bytes("9999"), nil)
+	if k, _ := c.Select(0); !bytes.Equal(k, Bytes("9999")) {
+		t.Fatalf("clone lost the comparator")
+	}
+}
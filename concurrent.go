@@ -0,0 +1,429 @@
+package btree
+
+import (
+	"hash/maphash"
+	"iter"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// iterBatchSize is the maximum number of pairs an iterator of ConcurrentBTree reads at a time
+	iterBatchSize = 64
+	// latchStripes is the number of leaf latches of a ConcurrentBTree, see latch
+	latchStripes = 64
+)
+
+// ConcurrentBTree is a BTree that is safe for concurrent use by any number of readers and writers.
+//
+// Operations that only read or modify a single leaf hold the tree lock shared and latch that leaf,
+// shared to read it and exclusively to modify it. Internal nodes aren't modified by these operations,
+// except for the key counts of their subtrees, which are updated atomically and only read with the tree
+// lock held exclusively. So lookups and writes that don't split or merge their leaf run in parallel,
+// as long as they are on leaves with different latches.
+// Writes that split or merge nodes, or that copy nodes shared with a snapshot, take the tree lock
+// exclusively, as do DeleteRange, Snapshot and the operations that need all of the tree to be consistent:
+// Rank, Select, RootHash, Prove, Validate and Stats.
+//
+// Iterators don't hold any lock while the loop body runs, they read the tree in batches of up to one leaf
+// and continue after the last yielded key, so the loop body may modify the tree. Every pair yielded was
+// in the tree when its batch was read, and keys are always yielded in order without repeats.
+type ConcurrentBTree[V any] struct {
+	mu      sync.RWMutex // held shared by operations on a single leaf, and exclusively by all others
+	tree    *BTree[V]
+	delta   atomic.Int64 // change in the number of keys not yet added to tree.count, see lock
+	latches [latchStripes]sync.RWMutex
+	seed    maphash.Seed
+}
+
+func NewConcurrentBTree[V any](degree int, expectedHeight int) *ConcurrentBTree[V] {
+	return &ConcurrentBTree[V]{tree: NewBTree[V](degree, expectedHeight), seed: maphash.MakeSeed()}
+}
+
+// lock takes the tree exclusively, after which it can be used as a plain BTree
+func (c *ConcurrentBTree[V]) lock() {
+	c.mu.Lock()
+	c.tree.count += int(c.delta.Swap(0))
+}
+
+// latch returns the latch of the leaf whose smallest keys are bounded by the separator low, nil for the
+// first leaf. Leaves don't carry latches, so that trees that aren't shared don't pay for them. Instead,
+// leaves are striped over a fixed set of latches by their separator, which identifies a leaf as long as
+// the tree lock is held shared, as separators only change with the tree lock held exclusively.
+// Leaves with the same latch can't be used in parallel, which doesn't affect correctness.
+func (c *ConcurrentBTree[V]) latch(low Bytes) *sync.RWMutex {
+	return &c.latches[maphash.Bytes(c.seed, low)%latchStripes]
+}
+
+func (c *ConcurrentBTree[V]) Degree() int {
+	return c.tree.Degree()
+}
+
+func (c *ConcurrentBTree[V]) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.tree.Len() + int(c.delta.Load())
+}
+
+// findLeaf returns the leaf with the first key within b used as a lower bound, or if last is true, the leaf
+// with the last key within b used as an upper bound. It also returns the separators around the leaf: the
+// keys of the leaf are at least low and smaller than high, and nil separators are unbounded.
+// The leaf can have no keys within b, in which case they are in the leaves beyond the separators.
+// Must be called with the tree lock held.
+func findLeaf[V any](n Node[V], b Bounds, last bool) (l *LeafNode[V], low, high Bytes) {
+	for !n.isLeaf() {
+		ni := n.(*InternalNode[V])
+		ci := 0
+		switch {
+		case last && b.kind == boundExcluded:
+			// keys smaller than a separator are all on its left
+			ci, _ = ni.search(b.key)
+		case b.kind != boundUnbounded:
+			ci = ni.childIndexForKey(b.key)
+		case last:
+			ci = ni.len() - 1
+		}
+		if ci > 0 {
+			low = ni.key(ci - 1)
+		}
+		if ci < len(ni.keys) {
+			high = ni.key(ci)
+		}
+		n = ni.pointers[ci]
+	}
+	return n.(*LeafNode[V]), low, high
+}
+
+func (c *ConcurrentBTree[V]) GetOp(key Bytes) *V {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	l, low, _ := findLeaf(c.tree.root, Included(key), false)
+	latch := c.latch(low)
+	latch.RLock()
+	defer latch.RUnlock()
+	if i, exists := l.search(key); exists {
+		return l.values[i]
+	}
+	return nil
+}
+
+func (c *ConcurrentBTree[V]) SetOp(key Bytes, value *V) error {
+	_, _, err := c.update(key, false, func(*V, bool) (*V, Action) {
+		return value, ActionSet
+	})
+	return err
+}
+
+func (c *ConcurrentBTree[V]) DelOp(key Bytes) (bool, error) {
+	_, exists, err := c.update(key, true, func(_ *V, exists bool) (*V, Action) {
+		if !exists {
+			return nil, ActionKeep
+		}
+		return nil, ActionDelete
+	})
+	return exists && err == nil, err
+}
+
+// update is BTree.update for the concurrent tree, deletes tells whether fn can return ActionDelete.
+// fn is called once, with the leaf latched, if the action it can return for the state of the key can be
+// applied to the leaf without splitting or merging it. Otherwise fn is called with the tree locked.
+func (c *ConcurrentBTree[V]) update(key Bytes, deletes bool, fn func(old *V, exists bool) (*V, Action)) (old *V, exists bool, err error) {
+	if old, exists, ok := c.updateLeaf(key, deletes, fn); ok {
+		return old, exists, nil
+	}
+	c.lock()
+	defer c.mu.Unlock()
+	return c.tree.update(key, fn)
+}
+
+// updateLeaf is the part of update that holds the tree lock shared, ok is false if fn wasn't called
+func (c *ConcurrentBTree[V]) updateLeaf(key Bytes, deletes bool, fn func(old *V, exists bool) (*V, Action)) (old *V, exists bool, ok bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	// nodes shared with snapshots have to be copied, which modifies their parents
+	ctx := c.tree.ctx
+	n := c.tree.root
+	if n.context() != ctx {
+		return nil, false, false
+	}
+	var buf [32]TraversalPositions[*V]
+	path := buf[:0]
+	var low Bytes
+	for !n.isLeaf() {
+		ni := n.(*InternalNode[*V])
+		ci := ni.childIndexForKey(key)
+		if ci > 0 {
+			low = ni.key(ci - 1)
+		}
+		path = append(path, TraversalPositions[*V]{node: ni, pos: ci})
+		n = ni.pointers[ci]
+		if n.context() != ctx {
+			return nil, false, false
+		}
+	}
+
+	l := n.(*LeafNode[*V])
+	latch := c.latch(low)
+	latch.Lock()
+	defer latch.Unlock()
+	idx, exists := l.search(key)
+	if exists && deletes && len(path) > 0 && l.len() <= l.minCount || !exists && l.len() == cap(l.keys) {
+		return nil, false, false
+	}
+	if exists {
+		old = l.values[idx]
+	}
+
+	value, action := fn(old, exists)
+	delta := 0
+	switch {
+	case action == ActionSet:
+		if _, _, inserted := l.setOrInsert(key, value); inserted {
+			delta = 1
+		}
+	case action == ActionDelete && exists:
+		l.delete(key)
+		delta = -1
+	default:
+		return old, exists, true
+	}
+
+	l.invalidateDigest()
+	for _, p := range path {
+		p.node.invalidateDigest()
+		if delta != 0 {
+			atomic.AddInt64(&p.node.counts[p.pos], int64(delta))
+		}
+	}
+	c.delta.Add(int64(delta))
+	return old, exists, true
+}
+
+func (c *ConcurrentBTree[V]) DeleteRange(low, high Bytes) (int, error) {
+	c.lock()
+	defer c.mu.Unlock()
+	return c.tree.DeleteRange(low, high)
+}
+
+// Update runs fn and applies its action atomically, fn must not use the tree. It is called once.
+func (c *ConcurrentBTree[V]) Update(key Bytes, fn func(old *V, exists bool) (new *V, action Action)) error {
+	_, _, err := c.update(key, true, fn)
+	return err
+}
+
+// GetOrInsert is BTree.GetOrInsert, see Update
+func (c *ConcurrentBTree[V]) GetOrInsert(key Bytes, value *V) (actual *V, loaded bool, err error) {
+	old, exists, err := c.update(key, false, func(_ *V, exists bool) (*V, Action) {
+		if exists {
+			return nil, ActionKeep
+		}
+		return value, ActionSet
+	})
+	if exists {
+		return old, true, err
+	}
+	return value, false, err
+}
+
+// CompareAndSwap is BTree.CompareAndSwap, see Update
+func (c *ConcurrentBTree[V]) CompareAndSwap(key Bytes, old, new *V) (swapped bool, err error) {
+	_, _, err = c.update(key, false, func(cur *V, exists bool) (*V, Action) {
+		if !exists || cur != old {
+			return nil, ActionKeep
+		}
+		swapped = true
+		return new, ActionSet
+	})
+	return swapped && err == nil, err
+}
+
+// InsertIfAbsent is BTree.InsertIfAbsent, see Update
+func (c *ConcurrentBTree[V]) InsertIfAbsent(key Bytes, value *V) (inserted bool, err error) {
+	_, loaded, err := c.GetOrInsert(key, value)
+	return !loaded && err == nil, err
+}
+
+func (c *ConcurrentBTree[V]) Rank(key Bytes) int {
+	c.lock()
+	defer c.mu.Unlock()
+	return c.tree.Rank(key)
+}
+
+func (c *ConcurrentBTree[V]) Select(i int) (Bytes, *V) {
+	c.lock()
+	defer c.mu.Unlock()
+	return c.tree.Select(i)
+}
+
+func (c *ConcurrentBTree[V]) Min() (Bytes, *V, bool) {
+	return firstPair(c.RangeBounds(Unbounded(), Unbounded()))
+}
+
+func (c *ConcurrentBTree[V]) Max() (Bytes, *V, bool) {
+	return firstPair(c.BackwardBounds(Unbounded(), Unbounded()))
+}
+
+func (c *ConcurrentBTree[V]) Floor(key Bytes) (Bytes, *V, bool) {
+	return firstPair(c.BackwardBounds(Unbounded(), Included(key)))
+}
+
+func (c *ConcurrentBTree[V]) Ceiling(key Bytes) (Bytes, *V, bool) {
+	return firstPair(c.RangeBounds(Included(key), Unbounded()))
+}
+
+func (c *ConcurrentBTree[V]) Lower(key Bytes) (Bytes, *V, bool) {
+	return firstPair(c.BackwardBounds(Unbounded(), Excluded(key)))
+}
+
+func (c *ConcurrentBTree[V]) Higher(key Bytes) (Bytes, *V, bool) {
+	return firstPair(c.RangeBounds(Excluded(key), Unbounded()))
+}
+
+func firstPair[V any](seq iter.Seq2[Bytes, *V]) (Bytes, *V, bool) {
+	for k, v := range seq {
+		return k, v, true
+	}
+	return nil, nil, false
+}
+
+func (c *ConcurrentBTree[V]) RootHash() Hash {
+	c.lock()
+	defer c.mu.Unlock()
+	return c.tree.RootHash()
+}
+
+func (c *ConcurrentBTree[V]) Prove(key Bytes) *Proof {
+	c.lock()
+	defer c.mu.Unlock()
+	return c.tree.Prove(key)
+}
+
+func (c *ConcurrentBTree[V]) Validate() error {
+	c.lock()
+	defer c.mu.Unlock()
+	return c.tree.Validate()
+}
+
+func (c *ConcurrentBTree[V]) Stats() Stats {
+	c.lock()
+	defer c.mu.Unlock()
+	return c.tree.Stats()
+}
+
+type kvPair[V any] struct {
+	key   Bytes
+	value *V
+}
+
+// batchIterator yields pairs read by next, one batch at a time. next gets the bound to continue from and
+// appends the following batch to buf, done is true if there are no pairs after the batch.
+func (c *ConcurrentBTree[V]) batchIterator(from Bounds, next func(from Bounds, buf []kvPair[V]) (batch []kvPair[V], rest Bounds, done bool)) iter.Seq2[Bytes, *V] {
+	return func(yield func(Bytes, *V) bool) {
+		buf := make([]kvPair[V], 0, iterBatchSize)
+		for done := false; !done; {
+			c.mu.RLock()
+			buf, from, done = next(from, buf[:0])
+			c.mu.RUnlock()
+
+			for _, p := range buf {
+				if !yield(p.key, p.value) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// Range iterates over the pairs with keys in [low, high) in ascending order
+func (c *ConcurrentBTree[V]) Range(low, high Bytes) iter.Seq2[Bytes, *V] {
+	return c.RangeBounds(nilBounds(low, high))
+}
+
+// Prefix iterates over the pairs with keys that start with p in ascending order, see BTree.Prefix
+func (c *ConcurrentBTree[V]) Prefix(p Bytes) iter.Seq2[Bytes, *V] {
+	return c.Range(p, PrefixEnd(p))
+}
+
+func (c *ConcurrentBTree[V]) All() iter.Seq2[Bytes, *V] {
+	return c.Range(nil, nil)
+}
+
+// Backward iterates over the pairs with keys in [low, high) in descending order.
+// A nil high means there is no upper bound.
+func (c *ConcurrentBTree[V]) Backward(low, high Bytes) iter.Seq2[Bytes, *V] {
+	return c.BackwardBounds(nilBounds(low, high))
+}
+
+// RangeBounds iterates over the pairs with keys between lo and hi in ascending order
+func (c *ConcurrentBTree[V]) RangeBounds(lo, hi Bounds) iter.Seq2[Bytes, *V] {
+	return c.batchIterator(lo, func(from Bounds, buf []kvPair[V]) ([]kvPair[V], Bounds, bool) {
+		cmp := c.tree.ctx.comparator()
+		l, low, high := findLeaf(c.tree.root, from, false)
+		latch := c.latch(low)
+		latch.RLock()
+		defer latch.RUnlock()
+
+		i := 0
+		if from.kind != boundUnbounded {
+			var exists bool
+			i, exists = l.search(from.key)
+			if exists && from.kind == boundExcluded {
+				i++
+			}
+		}
+		for ; i < l.len(); i++ {
+			k := l.key(i)
+			if !hi.admitsBelow(k, cmp) {
+				return buf, from, true
+			}
+			if len(buf) == iterBatchSize {
+				return buf, Excluded(buf[len(buf)-1].key), false
+			}
+			buf = append(buf, kvPair[V]{k, l.values[i]})
+		}
+		// the next leaf starts at the separator after this one
+		return buf, Included(high), high == nil
+	})
+}
+
+// BackwardBounds iterates over the pairs with keys between lo and hi in descending order
+func (c *ConcurrentBTree[V]) BackwardBounds(lo, hi Bounds) iter.Seq2[Bytes, *V] {
+	return c.batchIterator(hi, func(from Bounds, buf []kvPair[V]) ([]kvPair[V], Bounds, bool) {
+		cmp := c.tree.ctx.comparator()
+		l, low, _ := findLeaf(c.tree.root, from, true)
+		latch := c.latch(low)
+		latch.RLock()
+		defer latch.RUnlock()
+
+		i := l.len() - 1
+		if from.kind != boundUnbounded {
+			idx, exists := l.search(from.key)
+			i = idx - 1
+			if exists && from.kind == boundIncluded {
+				i = idx
+			}
+		}
+		for ; i >= 0; i-- {
+			k := l.key(i)
+			if !lo.admitsAbove(k, cmp) {
+				return buf, from, true
+			}
+			if len(buf) == iterBatchSize {
+				return buf, Excluded(buf[len(buf)-1].key), false
+			}
+			buf = append(buf, kvPair[V]{k, l.values[i]})
+		}
+		// the previous leaf ends before the separator before this one
+		return buf, Excluded(low), low == nil
+	})
+}
+
+// Snapshot returns a read-only view of the tree, which can be read without any locking while
+// the tree keeps being modified
+func (c *ConcurrentBTree[V]) Snapshot() *Snapshot[V] {
+	// taking a snapshot changes the context of the tree, so it needs the tree exclusively
+	c.lock()
+	defer c.mu.Unlock()
+	return c.tree.Snapshot()
+}
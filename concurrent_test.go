@@ -0,0 +1,219 @@
+package btree
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// Readers, writers and iterators running together must not race, run with -race
+func TestConcurrentReadersAndWriters(t *testing.T) {
+	c := NewConcurrentBTree[int](5, 4)
+	keys, values := GetData(4000)
+	for i := range keys[:2000] {
+		c.SetOp(keys[i][:], &values[i])
+	}
+
+	var wg sync.WaitGroup
+	for w := range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// each writer inserts its own quarter of the new keys and deletes a quarter of the old ones
+			for i := 2000 + w*500; i < 2000+(w+1)*500; i++ {
+				c.SetOp(keys[i][:], &values[i])
+				c.DelOp(keys[i-2000][:])
+			}
+		}()
+	}
+
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 2000 {
+				i := rand.Intn(len(keys))
+				if v := c.GetOp(keys[i][:]); v != nil && *v != values[i] {
+					t.Errorf("wrong value for key %d", i)
+					return
+				}
+				c.Rank(keys[i][:])
+			}
+		}()
+	}
+
+	for _, backward := range []bool{false, true} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 5 {
+				it := c.All()
+				if backward {
+					it = c.Backward(nil, nil)
+				}
+
+				var prev Bytes
+				for k := range it {
+					if prev != nil && (bytes.Compare(prev, k) >= 0) != backward {
+						t.Errorf("iteration out of order")
+						return
+					}
+					prev = k
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	want := map[Hash]int{}
+	for i := 2000; i < len(keys); i++ {
+		want[keys[i]] = values[i]
+	}
+	n := 0
+	for k, v := range c.All() {
+		if wv, ok := want[Hash(k)]; !ok || *v != wv {
+			t.Fatalf("unexpected pair after concurrent writes")
+		}
+		n++
+	}
+	if n != 2000 {
+		t.Fatalf("expected 2000 keys, got %d", n)
+	}
+}
+
+// The loop body of an iterator can modify the tree without deadlocking
+func TestConcurrentModifyWhileIterating(t *testing.T) {
+	c := NewConcurrentBTree[int](4, 4)
+	keys, values := GetData(500)
+	for i := range keys {
+		c.SetOp(keys[i][:], &values[i])
+	}
+
+	seen := 0
+	for k := range c.All() {
+		c.DelOp(k)
+		seen++
+	}
+	if seen != len(keys) {
+		t.Fatalf("expected %d keys, got %d", len(keys), seen)
+	}
+	for range c.All() {
+		t.Fatalf("tree should be empty")
+	}
+}
+
+// Applying the same operations to a ConcurrentBTree and a BTree must give the same tree, whether they take
+// the leaf-latched path or lock the tree, including after snapshots
+func TestConcurrentMatchesBTree(t *testing.T) {
+	b := NewBTree[int](4, 4)
+	c := NewConcurrentBTree[int](4, 4)
+	keys := sortedTestKeys(600)
+
+	for round := range 5 {
+		for range 1000 {
+			i := rand.Intn(len(keys))
+			k := keys[i]
+			switch rand.Intn(4) {
+			case 0:
+				bd, berr := b.DelOp(k)
+				cd, cerr := c.DelOp(k)
+				if bd != cd || berr != nil || cerr != nil {
+					t.Fatalf("DelOp returned %v %v and %v %v", bd, berr, cd, cerr)
+				}
+			case 1:
+				_, bl, _ := b.GetOrInsert(k, &i)
+				_, cl, _ := c.GetOrInsert(k, &i)
+				if bl != cl {
+					t.Fatalf("GetOrInsert returned %v and %v", bl, cl)
+				}
+			default:
+				if err := errors.Join(b.SetOp(k, &i), c.SetOp(k, &i)); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+		if round == 2 {
+			c.Snapshot()
+		}
+
+		if err := c.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if b.Len() != c.Len() || b.RootHash() != c.RootHash() {
+			t.Fatalf("trees differ: Len %d and %d", b.Len(), c.Len())
+		}
+		for range 200 {
+			k := keys[rand.Intn(len(keys))]
+			if b.Rank(k) != c.Rank(k) || b.GetOp(k) != c.GetOp(k) {
+				t.Fatalf("Rank or GetOp differ for %q", k)
+			}
+			for i, f := range [][2]func(Bytes) (Bytes, *int, bool){
+				{b.Floor, c.Floor}, {b.Ceiling, c.Ceiling}, {b.Lower, c.Lower}, {b.Higher, c.Higher},
+			} {
+				bk, bv, bok := f[0](k)
+				ck, cv, cok := f[1](k)
+				if !bytes.Equal(bk, ck) || bv != cv || bok != cok {
+					t.Fatalf("lookup %d differs for %q: %q and %q", i, k, bk, ck)
+				}
+			}
+		}
+		bk, _, _ := b.Min()
+		ck, _, _ := c.Min()
+		if !bytes.Equal(bk, ck) {
+			t.Fatalf("Min is %q and %q", bk, ck)
+		}
+		bk, _, _ = b.Max()
+		ck, _, _ = c.Max()
+		if !bytes.Equal(bk, ck) {
+			t.Fatalf("Max is %q and %q", bk, ck)
+		}
+	}
+}
+
+// Writers on different leaves run in parallel, the key counts they update atomically must add up
+func TestConcurrentWriters(t *testing.T) {
+	c := NewConcurrentBTree[int](16, 4)
+	keys, values := GetData(8000)
+
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := w; i < len(keys); i += 8 {
+				if err := c.SetOp(keys[i][:], &values[i]); err != nil {
+					t.Error(err)
+					return
+				}
+				if i%3 == 0 {
+					if _, err := c.DelOp(keys[i][:]); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	want := 0
+	for i := range keys {
+		if v := c.GetOp(keys[i][:]); (v != nil) != (i%3 != 0) {
+			t.Fatalf("key %d: got %v", i, v)
+		}
+		if i%3 != 0 {
+			want++
+		}
+	}
+	if c.Len() != want {
+		t.Fatalf("Len is %d, expected %d", c.Len(), want)
+	}
+	if k, _ := c.Select(want - 1); !bytes.Equal(k, collectKeys(c.Backward(nil, nil))[0]) {
+		t.Fatalf("Select of the last key returned %q", k)
+	}
+}
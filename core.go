@@ -0,0 +1,91 @@
+package btree
+
+// treeCore is a tree whose leaves store values of type E, with the operations shared by BTree, which
+// stores pointers to values, and ValueBTree, which stores values inline
+type treeCore[E any] struct {
+	root   Node[E] // root starts from being a *LeafNode[E] then changes to *InternalNode[E] after first split
+	deg    int     // defined as the number of pointers from each node
+	height int
+	count  int // number of keys in the tree
+	stack  Stack[TraversalPositions[E]]
+	ctx    *treeContext // nodes of other contexts are shared with clones of the tree
+}
+
+func newTreeCore[E any](degree int, expectedHeight int, ctx *treeContext) treeCore[E] {
+	root := newLeafNode[E](degree - 1)
+	root.ctx = ctx
+	// expectedHeight parameter helps reduce number of allocations for stack expansion
+	return treeCore[E]{
+		root:   root,
+		deg:    degree,
+		height: 0,
+		stack:  NewStack[TraversalPositions[E]](expectedHeight),
+		ctx:    ctx,
+	}
+}
+
+// mutableRoot returns the root, first replacing it with a copy if it's shared with a clone
+func (b *treeCore[E]) mutableRoot() Node[E] {
+	if b.root.context() != b.ctx {
+		b.root = b.root.clone(b.ctx)
+	}
+	b.root.invalidateDigest()
+	return b.root
+}
+
+// finishInsert updates the count and handles the split of the root after an insertion
+func (b *treeCore[E]) finishInsert(key Bytes, newNode Node[E], inserted bool, err error) error {
+	if err != nil {
+		return err
+	}
+	if inserted {
+		b.count++
+	}
+	if newNode != nil {
+		root := newInternalNode[E](b.deg)
+		root.ctx = b.ctx
+		root.keys = append(root.keys, key)
+		root.pointers = append(root.pointers, b.root, newNode)
+		root.counts = append(root.counts, int64(b.root.size()), int64(newNode.size()))
+		root.encodeKeys()
+
+		b.root = root
+		b.height++
+		if cap(b.stack) < b.height {
+			b.stack = NewStack[TraversalPositions[E]](2 * b.height)
+		}
+	}
+	return nil
+}
+
+// finishDelete updates the count and removes a root with a single child after a deletion
+func (b *treeCore[E]) finishDelete(del bool, err error) (bool, error) {
+	if err != nil {
+		return false, err
+	}
+	if del {
+		b.count--
+	}
+	if del && !b.root.isLeaf() {
+		ri := b.root.(*InternalNode[E])
+		if ri.len() == 1 {
+			b.root = ri.pointers[0]
+			b.height--
+		}
+	}
+	return del, nil
+}
+
+// clone returns a copy of the tree that shares all nodes with it, see BTree.Clone
+func (b *treeCore[E]) clone() treeCore[E] {
+	c := *b
+	b.ctx, c.ctx = b.ctx.fork(), b.ctx.fork()
+	c.stack = NewStack[TraversalPositions[E]](cap(b.stack))
+	return c
+}
+
+// validate checks the invariants of the tree, see BTree.Validate
+func (b *treeCore[E]) validate() error {
+	v := validator[E]{ctx: b.ctx, cmp: b.ctx.comparator(), height: b.height}
+	return v.node(b.root, nil, nil, nil)
+}
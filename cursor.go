@@ -0,0 +1,165 @@
+package btree
+
+// Cursor is a bidirectional iterator over the pairs of a BTree.
+// A cursor is positioned on a single pair or is invalid, which happens when it is
+// created or moves past either end of the tree.
+// Modifying the tree invalidates all its cursors, they must be repositioned using Seek, First or Last.
+//
+// The cursor moves between leaves using the path from the root instead of the leaf links,
+// as the links aren't maintained between leaves shared by cloned trees.
+type Cursor[V any] struct {
+	cursor[*V]
+}
+
+// cursor is a Cursor over a treeCore, which BTree, ValueBTree and BTreeSet iterate with
+type cursor[E any] struct {
+	tree *treeCore[E]
+	path Stack[TraversalPositions[E]] // path from the root to leaf
+	leaf *LeafNode[E]
+	idx  int
+}
+
+func newCursor[E any](t *treeCore[E]) cursor[E] {
+	return cursor[E]{tree: t, path: NewStack[TraversalPositions[E]](t.height + 1)}
+}
+
+func (b *BTree[V]) Cursor() *Cursor[V] {
+	return &Cursor[V]{newCursor(&b.treeCore)}
+}
+
+// Valid returns true if the cursor is positioned on a pair
+func (c *cursor[E]) Valid() bool {
+	return c.leaf != nil && c.idx >= 0 && c.idx < c.leaf.len()
+}
+
+func (c *cursor[E]) Key() Bytes {
+	if !c.Valid() {
+		return nil
+	}
+	return c.leaf.key(c.idx)
+}
+
+func (c *Cursor[V]) Value() *V {
+	return c.value()
+}
+
+// value returns the value of the current pair, the zero value if the cursor is invalid
+func (c *cursor[E]) value() E {
+	if !c.Valid() {
+		var zero E
+		return zero
+	}
+	return c.leaf.values[c.idx]
+}
+
+// seekLeaf positions the cursor at the lower bound of key in the leaf where key is or would be
+func (c *cursor[E]) seekLeaf(key Bytes) {
+	c.path.Clear()
+	c.leaf, c.path = leafAndPathForKey(c.tree.root, key, c.path)
+	c.idx, _ = c.leaf.search(key)
+}
+
+// Seek positions the cursor at the smallest key that is greater than or equal to key,
+// or at the first key if key is nil
+func (c *cursor[E]) Seek(key Bytes) bool {
+	if key == nil {
+		return c.First()
+	}
+	c.seekLeaf(key)
+	if c.idx >= c.leaf.len() {
+		return c.nextLeaf()
+	}
+	return true
+}
+
+// SeekBefore positions the cursor at the largest key that is strictly smaller than key
+func (c *cursor[E]) SeekBefore(key Bytes) bool {
+	c.seekLeaf(key)
+	return c.Prev()
+}
+
+// First positions the cursor at the smallest key in the tree
+func (c *cursor[E]) First() bool {
+	c.path.Clear()
+	c.descend(c.tree.root, false)
+	return c.Valid()
+}
+
+// Last positions the cursor at the largest key in the tree
+func (c *cursor[E]) Last() bool {
+	c.path.Clear()
+	c.descend(c.tree.root, true)
+	return c.Valid()
+}
+
+// descend moves the cursor to the first or the last pair of the subtree under n
+func (c *cursor[E]) descend(n Node[E], last bool) {
+	for !n.isLeaf() {
+		ni := n.(*InternalNode[E])
+		pos := 0
+		if last {
+			pos = ni.len() - 1
+		}
+		c.path.Push(TraversalPositions[E]{node: ni, pos: pos})
+		n = ni.pointers[pos]
+	}
+
+	c.leaf, c.idx = n.(*LeafNode[E]), 0
+	if last {
+		c.idx = c.leaf.len() - 1
+	}
+}
+
+// nextLeaf moves the cursor to the first pair of the leaf after the current one
+func (c *cursor[E]) nextLeaf() bool {
+	for !c.path.Empty() {
+		top := c.path.Top()
+		if top.pos+1 < top.node.len() {
+			top.pos++
+			c.descend(top.node.pointers[top.pos], false)
+			return c.Valid()
+		}
+		c.path.Pop()
+	}
+	c.leaf = nil
+	return false
+}
+
+// prevLeaf moves the cursor to the last pair of the leaf before the current one
+func (c *cursor[E]) prevLeaf() bool {
+	for !c.path.Empty() {
+		top := c.path.Top()
+		if top.pos > 0 {
+			top.pos--
+			c.descend(top.node.pointers[top.pos], true)
+			return c.Valid()
+		}
+		c.path.Pop()
+	}
+	c.leaf = nil
+	return false
+}
+
+// Next moves the cursor to the next larger key
+func (c *cursor[E]) Next() bool {
+	if c.leaf == nil {
+		return false
+	}
+	c.idx++
+	if c.idx >= c.leaf.len() {
+		return c.nextLeaf()
+	}
+	return true
+}
+
+// Prev moves the cursor to the next smaller key
+func (c *cursor[E]) Prev() bool {
+	if c.leaf == nil {
+		return false
+	}
+	c.idx--
+	if c.idx < 0 {
+		return c.prevLeaf()
+	}
+	return true
+}
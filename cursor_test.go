@@ -0,0 +1,101 @@
+package btree
+
+import (
+	"bytes"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// Cursor must visit all keys in ascending order with Next and in descending order with Prev
+func TestCursorBothDirections(t *testing.T) {
+	m, _, keys := buildComparableMaps(1000, 4)
+	c := m.Cursor()
+
+	i := 0
+	for ok := c.First(); ok; ok = c.Next() {
+		if !bytes.Equal(c.Key(), keys[i][:]) {
+			t.Fatalf("forward: key %d out of order", i)
+		}
+		i++
+	}
+	if i != len(keys) {
+		t.Fatalf("forward: expected %d keys, got %d", len(keys), i)
+	}
+
+	i = len(keys) - 1
+	for ok := c.Last(); ok; ok = c.Prev() {
+		if !bytes.Equal(c.Key(), keys[i][:]) {
+			t.Fatalf("backward: key %d out of order", i)
+		}
+		i--
+	}
+	if i != -1 {
+		t.Fatalf("backward: %d keys not visited", i+1)
+	}
+}
+
+func TestCursorSeek(t *testing.T) {
+	m, _, keys := buildComparableMaps(500, 3)
+	c := m.Cursor()
+
+	for i, key := range keys {
+		if !c.Seek(key[:]) || !bytes.Equal(c.Key(), key[:]) {
+			t.Fatalf("seek to existing key %d failed", i)
+		}
+		if c.Prev() != (i > 0) {
+			t.Fatalf("prev after seek to key %d", i)
+		}
+		if i > 0 && !bytes.Equal(c.Key(), keys[i-1][:]) {
+			t.Fatalf("prev after seek to key %d gave wrong key", i)
+		}
+
+		// a key just larger than key i must seek to key i+1
+		larger := append(slices.Clone(key[:]), 0)
+		if c.Seek(larger) != (i < len(keys)-1) {
+			t.Fatalf("seek past key %d", i)
+		}
+		if i < len(keys)-1 && !bytes.Equal(c.Key(), keys[i+1][:]) {
+			t.Fatalf("seek past key %d gave wrong key", i)
+		}
+	}
+
+	empty := NewBTree[int](3, 1)
+	c = empty.Cursor()
+	if c.First() || c.Last() || c.Seek(nil) || c.Next() || c.Prev() {
+		t.Errorf("cursor on empty tree must be invalid")
+	}
+}
+
+// Backward must yield exactly the reverse of Range, including after deletions that merge leaves
+func TestTreeBackward(t *testing.T) {
+	m, _, keys := buildComparableMaps(2000, 5)
+	rand.Shuffle(len(keys), func(i, j int) {
+		keys[i], keys[j] = keys[j], keys[i]
+	})
+	for _, key := range keys[:1500] {
+		m.Del(key)
+	}
+	runMapHealthTests(t, m, 500, true)
+
+	low, high := Bytes("F"), Bytes("t")
+	var fwd, bwd []Bytes
+	for k := range m.Range(low, high) {
+		fwd = append(fwd, k)
+	}
+	for k := range m.Backward(low, high) {
+		bwd = append(bwd, k)
+	}
+	slices.Reverse(bwd)
+	if slices.CompareFunc(fwd, bwd, bytes.Compare) != 0 {
+		t.Fatalf("backward iteration differs from reversed forward iteration")
+	}
+
+	n := 0
+	for range m.Backward(nil, nil) {
+		n++
+	}
+	if n != 500 {
+		t.Fatalf("expected 500 keys in backward iteration, got %d", n)
+	}
+}
@@ -0,0 +1,190 @@
+package btree
+
+import (
+	"slices"
+)
+
+// DeleteRange deletes the keys in [low, high) and returns how many it deleted. Nil bounds are unbounded.
+// Subtrees that are fully inside the range are dropped without visiting them, so only the nodes on the
+// paths to low and high are copied or modified, and then rebalanced bottom-up.
+// It returns ErrCorrupt if the tree breaks its invariants.
+func (b *BTree[V]) DeleteRange(low, high Bytes) (int, error) {
+	if low != nil && high != nil && b.ctx.compare(low, high) >= 0 {
+		return 0, nil
+	}
+	if low == nil && high == nil {
+		deleted := b.count
+		root := newLeafNode[*V](b.deg - 1)
+		root.ctx = b.ctx
+		b.root, b.height, b.count = root, 0, 0
+		return deleted, nil
+	}
+
+	deleted := deleteRange(b.mutableRoot(), low, high)
+	if deleted == 0 {
+		return 0, nil
+	}
+	b.count -= deleted
+	b.linkRangeEnds(low, high)
+
+	if t, ok := b.root.(*InternalNode[*V]); ok {
+		if err := t.repairRange(low, high); err != nil {
+			return deleted, err
+		}
+	}
+	for !b.root.isLeaf() && b.root.len() == 1 {
+		b.root = b.root.(*InternalNode[*V]).pointers[0]
+		b.height--
+	}
+	return deleted, nil
+}
+
+// linkRangeEnds links the leaves on the two sides of a deleted range, which were not adjacent before.
+// Both are on the paths modified by deleteRange, so they belong to the tree.
+func (b *BTree[V]) linkRangeEnds(low, high Bytes) {
+	var left, right *LeafNode[*V]
+	if low != nil {
+		left, _ = leafAndPathForKey(b.root, low, nil)
+	}
+	if high != nil {
+		right, _ = leafAndPathForKey(b.root, high, nil)
+	}
+	if left == right {
+		return
+	}
+	if left != nil {
+		left.next = right
+	}
+	if right != nil {
+		right.prev = left
+	}
+}
+
+// deleteRange deletes the keys in [low, high) from the subtree under n, which must belong to the tree, and
+// returns how many it deleted. low and high can't both be nil.
+// The nodes on the paths to low and high can be left underfull, see InternalNode.repairRange.
+func deleteRange[V any](n Node[V], low, high Bytes) int {
+	if l, ok := n.(*LeafNode[V]); ok {
+		return l.deleteRange(low, high)
+	}
+	return n.(*InternalNode[V]).deleteRange(low, high)
+}
+
+func (l *LeafNode[V]) deleteRange(low, high Bytes) int {
+	start, end := 0, l.len()
+	if low != nil {
+		start, _ = l.search(low)
+	}
+	if high != nil {
+		end, _ = l.search(high)
+	}
+	if start >= end {
+		return 0
+	}
+	l.keys = slices.Delete(l.keys, start, end)
+	l.values = slices.Delete(l.values, start, end)
+	return end - start
+}
+
+func (t *InternalNode[V]) deleteRange(low, high Bytes) int {
+	lo, hi := 0, t.len()-1
+	if low != nil {
+		lo = t.childIndexForKey(low)
+	}
+	if high != nil {
+		hi = t.childIndexForKey(high)
+	}
+	if lo == hi {
+		c := t.mutableChild(lo)
+		deleted := deleteRange(c, low, high)
+		t.counts[lo] = int64(c.size())
+		return deleted
+	}
+
+	// children between the ones containing the bounds are fully inside the range, and so are the ones
+	// containing an unbounded end
+	first, last := lo+1, hi-1
+	if low == nil {
+		first = lo
+	}
+	if high == nil {
+		last = hi
+	}
+	deleted := 0
+	for i := first; i <= last; i++ {
+		deleted += int(t.counts[i])
+	}
+	if first <= last {
+		// the separator before each dropped child goes with it, or the one after it for the first child
+		if first > 0 {
+			t.keys = slices.Delete(t.keys, first-1, last)
+		} else {
+			t.keys = slices.Delete(t.keys, 0, last+1)
+		}
+		t.pointers = slices.Delete(t.pointers, first, last+1)
+		t.counts = slices.Delete(t.counts, first, last+1)
+	}
+
+	i := lo
+	if low != nil {
+		c := t.mutableChild(i)
+		deleted += deleteRange(c, low, nil)
+		t.counts[i] = int64(c.size())
+		i++
+	}
+	if high != nil {
+		c := t.mutableChild(i)
+		deleted += deleteRange(c, nil, high)
+		t.counts[i] = int64(c.size())
+	}
+	return deleted
+}
+
+// repairRange rebalances the nodes left underfull by deleteRange in the subtree under the node, which are
+// on the paths to low and high, bottom-up
+func (t *InternalNode[V]) repairRange(low, high Bytes) error {
+	done := -1
+	for _, k := range [2]Bytes{low, high} {
+		if k == nil {
+			continue
+		}
+		i := t.childIndexForKey(k)
+		if i == done || t.pointers[i].isLeaf() {
+			continue
+		}
+		if err := t.mutableChild(i).(*InternalNode[V]).repairRange(low, high); err != nil {
+			return err
+		}
+		done = i
+	}
+	return t.repairChildren()
+}
+
+// repairChildren rebalances the underfull children of the node with their siblings. Nodes can be far
+// below the minimum after a range deletion, so a merged node can need another merge, and the children
+// of the rebalanced nodes are repaired in turn, as nodes that had no sibling can now have one.
+func (t *InternalNode[V]) repairChildren() error {
+	for i := 0; i < t.len() && t.len() > 1; {
+		if !t.pointers[i].needsRebalance() {
+			i++
+			continue
+		}
+		dkIdx, merged, err := t.rebalanceChild(i)
+		if err != nil {
+			return err
+		}
+		rebalanced := t.pointers[dkIdx : dkIdx+2]
+		if merged {
+			rebalanced = rebalanced[:1]
+		}
+		for _, n := range rebalanced {
+			if c, ok := n.(*InternalNode[V]); ok {
+				if err := c.repairChildren(); err != nil {
+					return err
+				}
+			}
+		}
+		i = dkIdx
+	}
+	return nil
+}
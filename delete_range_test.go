@@ -0,0 +1,126 @@
+package btree
+
+import (
+	"bytes"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// deleteRangeFromMap deletes the keys in [low, high) from want and returns how many it deleted
+func deleteRangeFromMap(want map[Hash]int, low, high Bytes) int {
+	n := 0
+	for k := range want {
+		if (low == nil || bytes.Compare(k[:], low) >= 0) && (high == nil || bytes.Compare(k[:], high) < 0) {
+			delete(want, k)
+			n++
+		}
+	}
+	return n
+}
+
+// randomBound returns nil, one of the keys, or a key that isn't one of them but is next to one
+func randomBound(keys []Bytes) Bytes {
+	k := keys[rand.Intn(len(keys))]
+	switch rand.Intn(8) {
+	case 0:
+		return nil
+	case 1: // between k and the next key
+		return append(slices.Clip(k), 0)
+	}
+	return k
+}
+
+// Deleting random ranges must leave the same keys as deleting them one by one, in a valid tree
+func TestDeleteRange(t *testing.T) {
+	for _, degree := range []int{3, 4, 5, 8, 33} {
+		for range 30 {
+			b := NewBTree[int](degree, 4)
+			keys, values := GetData(2000)
+			want := map[Hash]int{}
+			bounds := make([]Bytes, len(keys))
+			for i := range keys {
+				b.SetOp(keys[i][:], &values[i])
+				want[keys[i]] = values[i]
+				bounds[i] = keys[i][:]
+			}
+
+			for range 3 {
+				low, high := randomBound(bounds), randomBound(bounds)
+				if low != nil && high != nil && bytes.Compare(low, high) > 0 {
+					low, high = high, low
+				}
+				wn := deleteRangeFromMap(want, low, high)
+				n, err := b.DeleteRange(low, high)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if n != wn {
+					t.Fatalf("degree %d: deleted %d keys, expected %d", degree, n, wn)
+				}
+				checkTreeContents(t, b, want)
+			}
+
+			// the tree must still work after the range deletions
+			for i := range keys[:500] {
+				b.SetOp(keys[i][:], &values[i])
+				want[keys[i]] = values[i]
+			}
+			checkTreeContents(t, b, want)
+		}
+	}
+}
+
+func TestDeleteRangeBounds(t *testing.T) {
+	b := NewBTree[int](4, 4)
+	keys, values := GetData(300)
+	for i := range keys {
+		b.SetOp(keys[i][:], &values[i])
+	}
+
+	if n, _ := b.DeleteRange(keys[1][:], keys[1][:]); n != 0 || b.Len() != len(keys) {
+		t.Fatalf("empty range deleted %d keys", n)
+	}
+	if n, _ := b.DeleteRange(nil, nil); n != len(keys) {
+		t.Fatalf("deleted %d keys, expected %d", n, len(keys))
+	}
+	checkTreeContents(t, b, map[Hash]int{})
+	if n, _ := b.DeleteRange(nil, nil); n != 0 {
+		t.Fatalf("deleted %d keys from an empty tree", n)
+	}
+}
+
+// A range deletion must copy the modified nodes of a clone instead of changing them
+func TestDeleteRangeOnClone(t *testing.T) {
+	b := NewBTree[int](4, 4)
+	keys, values := GetData(3000)
+	want := map[Hash]int{}
+	for i := range keys {
+		b.SetOp(keys[i][:], &values[i])
+		want[keys[i]] = values[i]
+	}
+	hash := b.RootHash()
+
+	c := b.Clone()
+	wantC := map[Hash]int{}
+	for k, v := range want {
+		wantC[k] = v
+	}
+	low, high := Bytes{0x20}, Bytes{0xd0}
+	n, err := c.DeleteRange(low, high)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if wn := deleteRangeFromMap(wantC, low, high); n != wn {
+		t.Fatalf("deleted %d keys, expected %d", n, wn)
+	}
+
+	checkTreeContents(t, b, want)
+	checkTreeContents(t, c, wantC)
+	if b.RootHash() != hash {
+		t.Fatalf("range deletion on a clone changed the root hash of the tree")
+	}
+	if c.RootHash() == hash {
+		t.Fatalf("range deletion didn't change the root hash")
+	}
+}
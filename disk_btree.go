@@ -0,0 +1,609 @@
+package btree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"iter"
+)
+
+const (
+	diskMagic   = "BTREEPG1"
+	metaPageID  = pageID(0)
+	metaPageLen = 8 + 4*4 + 8 + 4 + 8 + 8 + 8
+
+	DefaultPageSize     = 4096
+	MaxPageSize         = 1 << 16 // the number of keys of a page has to fit in 16 bits
+	DefaultMaxKeySize   = 64
+	DefaultMaxValueSize = 256
+	DefaultCachePages   = 256
+)
+
+var (
+	ErrKeyTooLarge   = errors.New("btree: key is larger than the maximum key size")
+	ErrValueTooLarge = errors.New("btree: value is larger than the maximum value size")
+)
+
+// DiskOptions configures a DiskBTree. Zero fields take their default values.
+// PageSize, MaxKeySize and MaxValueSize are only used when a new file is created,
+// existing files keep the values they were created with.
+type DiskOptions struct {
+	PageSize     int
+	MaxKeySize   int
+	MaxValueSize int
+	CachePages   int // maximum number of pages held in the buffer pool
+}
+
+func (o DiskOptions) withDefaults() DiskOptions {
+	if o.PageSize == 0 {
+		o.PageSize = DefaultPageSize
+	}
+	if o.MaxKeySize == 0 {
+		o.MaxKeySize = DefaultMaxKeySize
+	}
+	if o.MaxValueSize == 0 {
+		o.MaxValueSize = DefaultMaxValueSize
+	}
+	if o.CachePages == 0 {
+		o.CachePages = DefaultCachePages
+	}
+	return o
+}
+
+// diskMeta is the content of the first page of the file
+type diskMeta struct {
+	pageSize     uint32
+	maxKeySize   uint32
+	maxValueSize uint32
+	degree       uint32
+	root         pageID
+	height       uint32
+	numPages     uint64 // pages in use or in the free list, including the meta page
+	freeHead     pageID // first page of the free list, pages in the list are linked through their first bytes
+	count        uint64 // number of keys in the tree
+}
+
+func (m *diskMeta) encode(buf []byte) []byte {
+	buf = append(buf[:0], diskMagic...)
+	buf = binary.LittleEndian.AppendUint32(buf, m.pageSize)
+	buf = binary.LittleEndian.AppendUint32(buf, m.maxKeySize)
+	buf = binary.LittleEndian.AppendUint32(buf, m.maxValueSize)
+	buf = binary.LittleEndian.AppendUint32(buf, m.degree)
+	buf = binary.LittleEndian.AppendUint64(buf, m.root)
+	buf = binary.LittleEndian.AppendUint32(buf, m.height)
+	buf = binary.LittleEndian.AppendUint64(buf, m.numPages)
+	buf = binary.LittleEndian.AppendUint64(buf, m.freeHead)
+	buf = binary.LittleEndian.AppendUint64(buf, m.count)
+	return buf
+}
+
+func decodeDiskMeta(page []byte) (diskMeta, error) {
+	var m diskMeta
+	if len(page) < metaPageLen || string(page[:8]) != diskMagic {
+		return m, fmt.Errorf("%w: bad meta page", errCorruptPage)
+	}
+	page = page[8:]
+	m.pageSize = binary.LittleEndian.Uint32(page[0:])
+	m.maxKeySize = binary.LittleEndian.Uint32(page[4:])
+	m.maxValueSize = binary.LittleEndian.Uint32(page[8:])
+	m.degree = binary.LittleEndian.Uint32(page[12:])
+	m.root = binary.LittleEndian.Uint64(page[16:])
+	m.height = binary.LittleEndian.Uint32(page[24:])
+	m.numPages = binary.LittleEndian.Uint64(page[28:])
+	m.freeHead = binary.LittleEndian.Uint64(page[36:])
+	m.count = binary.LittleEndian.Uint64(page[44:])
+	return m, nil
+}
+
+// check returns errCorruptPage if the sizes of the meta page don't describe a tree that can be opened,
+// as the page size and degree are used to size buffers and split nodes
+func (m *diskMeta) check() error {
+	if m.pageSize < metaPageLen || m.pageSize > MaxPageSize || m.maxKeySize > 1<<16-1 || m.maxValueSize > 1<<16-1 {
+		return fmt.Errorf("%w: meta page has page size %d, maximum key size %d and maximum value size %d",
+			errCorruptPage, m.pageSize, m.maxKeySize, m.maxValueSize)
+	}
+	deg := diskDegree(int(m.pageSize), int(m.maxKeySize), int(m.maxValueSize))
+	if deg < 3 || m.degree != uint32(deg) {
+		return fmt.Errorf("%w: meta page has degree %d, its sizes give %d", errCorruptPage, m.degree, deg)
+	}
+	return nil
+}
+
+// diskDegree returns the largest degree for which any node fits in a page
+func diskDegree(pageSize, maxKeySize, maxValueSize int) int {
+	leafKeys := (pageSize - leafHeaderSize) / (2*lenPrefixSize + maxKeySize + maxValueSize)
+	internalKeys := (pageSize - internalHeaderSize - 8) / (lenPrefixSize + maxKeySize + 8)
+	return min(leafKeys+1, internalKeys+1)
+}
+
+type diskPathEntry struct {
+	node *diskNode
+	pos  int
+}
+
+// DiskBTree is a B+ tree with byte array keys and values whose nodes are stored as fixed-size pages
+// of a single file. Pages are cached in a bounded buffer pool, and pages of deleted nodes are reused
+// through a free list. Changes reach the file when pages are evicted from the pool, on Sync and on Close.
+// DiskBTree isn't safe for concurrent use.
+//
+// Pages are updated in place, so the file is only consistent after Sync or Close returns. Sync writes the
+// meta page after all other pages, but pages evicted between syncs are written in any order, and a crash
+// at any time other than right after a Sync can leave a file whose meta page and nodes don't match.
+// DiskBTree doesn't log its changes, callers that need crash recovery have to keep their own log.
+type DiskBTree struct {
+	pager *pager
+	pool  *bufferPool
+	meta  diskMeta
+	deg   int
+	stack Stack[diskPathEntry]
+	buf   []byte // scratch buffer for encoding pages
+	err   error  // first error hit by an iterator
+}
+
+// OpenDiskBTree opens the tree stored at path, creating a new file if it doesn't exist
+func OpenDiskBTree(path string, opts DiskOptions) (*DiskBTree, error) {
+	opts = opts.withDefaults()
+	p, err := openPager(path, opts.PageSize)
+	if err != nil {
+		return nil, err
+	}
+	empty, err := p.empty()
+	if err != nil {
+		_ = p.close()
+		return nil, err
+	}
+
+	d := &DiskBTree{pager: p}
+	if empty {
+		err = d.initFile(opts)
+	} else {
+		err = d.loadMeta()
+	}
+	if err != nil {
+		_ = p.close()
+		return nil, err
+	}
+
+	d.pool = newBufferPool(d.pager, max(opts.CachePages, 2))
+	d.stack = NewStack[diskPathEntry](int(d.meta.height) + 1)
+	return d, nil
+}
+
+func (d *DiskBTree) initFile(opts DiskOptions) error {
+	if opts.PageSize > MaxPageSize {
+		return fmt.Errorf("btree: page size %d is larger than %d", opts.PageSize, MaxPageSize)
+	}
+	if opts.MaxKeySize > 1<<16-1 || opts.MaxValueSize > 1<<16-1 {
+		return errors.New("btree: keys and values must be smaller than 64KiB")
+	}
+	deg := diskDegree(opts.PageSize, opts.MaxKeySize, opts.MaxValueSize)
+	if deg < 3 {
+		return fmt.Errorf("btree: page size %d too small for keys of %d bytes and values of %d bytes",
+			opts.PageSize, opts.MaxKeySize, opts.MaxValueSize)
+	}
+
+	d.meta = diskMeta{
+		pageSize:     uint32(opts.PageSize),
+		maxKeySize:   uint32(opts.MaxKeySize),
+		maxValueSize: uint32(opts.MaxValueSize),
+		degree:       uint32(deg),
+		root:         1,
+		numPages:     2,
+	}
+	d.deg = deg
+	d.buf = make([]byte, 0, opts.PageSize)
+
+	root := &diskNode{id: d.meta.root, leaf: true}
+	if err := d.pager.writePage(root.id, d.pageBuf(root.encode(d.buf))); err != nil {
+		return err
+	}
+	if err := d.pager.writePage(metaPageID, d.pageBuf(d.meta.encode(d.buf))); err != nil {
+		return err
+	}
+	return d.pager.sync()
+}
+
+func (d *DiskBTree) loadMeta() error {
+	// the page size isn't known before reading the meta page, so its fixed size prefix is read first
+	head := make([]byte, metaPageLen)
+	if _, err := d.pager.file.ReadAt(head, 0); err != nil {
+		return fmt.Errorf("btree: reading meta page: %w", err)
+	}
+	m, err := decodeDiskMeta(head)
+	if err != nil {
+		return err
+	}
+	if err := m.check(); err != nil {
+		return err
+	}
+
+	d.meta = m
+	d.deg = int(m.degree)
+	d.pager.pageSize = int(m.pageSize)
+	d.buf = make([]byte, 0, m.pageSize)
+	return nil
+}
+
+// pageBuf pads an encoded page with zeroes to the full page size
+func (d *DiskBTree) pageBuf(b []byte) []byte {
+	page := b[:d.pager.pageSize]
+	clear(page[len(b):])
+	return page
+}
+
+func (d *DiskBTree) Degree() int {
+	return d.deg
+}
+
+// Len returns the number of keys in the tree, which is stored in the meta page
+func (d *DiskBTree) Len() int {
+	return int(d.meta.count)
+}
+
+func (d *DiskBTree) maxLeafKeys() int { return d.deg - 1 }
+
+func (d *DiskBTree) minLeafKeys() int { return ceilDiv(d.deg-1, 2) }
+
+func (d *DiskBTree) minChildren() int { return ceilDiv(d.deg, 2) }
+
+func (d *DiskBTree) readNode(id pageID) (*diskNode, error) {
+	page, err := d.pool.fetch(id)
+	if err != nil {
+		return nil, err
+	}
+	return decodeDiskNode(id, page)
+}
+
+func (d *DiskBTree) writeNode(n *diskNode) error {
+	return d.pool.update(n.id, n.encode(d.buf))
+}
+
+func (d *DiskBTree) writeMeta() error {
+	return d.pool.update(metaPageID, d.meta.encode(d.buf))
+}
+
+// allocPage returns a page from the free list, or grows the file if the list is empty
+func (d *DiskBTree) allocPage() (pageID, error) {
+	if d.meta.freeHead == nullPage {
+		id := d.meta.numPages
+		d.meta.numPages++
+		return id, nil
+	}
+
+	id := d.meta.freeHead
+	page, err := d.pool.fetch(id)
+	if err != nil {
+		return nullPage, err
+	}
+	if page[0] != pageTypeFree {
+		return nullPage, fmt.Errorf("%w: page %d in free list has type %d", errCorruptPage, id, page[0])
+	}
+	d.meta.freeHead = binary.LittleEndian.Uint64(page[1:])
+	return id, nil
+}
+
+// freePage pushes the page to the front of the free list
+func (d *DiskBTree) freePage(id pageID) error {
+	buf := append(d.buf[:0], pageTypeFree)
+	buf = binary.LittleEndian.AppendUint64(buf, d.meta.freeHead)
+	d.meta.freeHead = id
+	return d.pool.update(id, buf)
+}
+
+// leafAndPathForKey returns the leaf where key is or would be, pushing the internal nodes on the way
+// to the stack if it's not nil
+func (d *DiskBTree) leafAndPathForKey(key Bytes, st *Stack[diskPathEntry]) (*diskNode, error) {
+	n, err := d.readNode(d.meta.root)
+	for err == nil && !n.leaf {
+		pos, exists := lowerBoundBytesArr(n.keys, key)
+		if exists {
+			pos++
+		}
+		if st != nil {
+			st.Push(diskPathEntry{node: n, pos: pos})
+		}
+		n, err = d.readNode(n.children[pos])
+	}
+	return n, err
+}
+
+func (d *DiskBTree) GetOp(key Bytes) (*Bytes, error) {
+	l, err := d.leafAndPathForKey(key, nil)
+	if err != nil {
+		return nil, err
+	}
+	if i, exists := lowerBoundBytesArr(l.keys, key); exists {
+		return &l.values[i], nil
+	}
+	return nil, nil
+}
+
+// SetOp sets/inserts the given key-value pair in the tree. A nil value is stored as an empty value.
+func (d *DiskBTree) SetOp(key Bytes, value *Bytes) error {
+	var v Bytes
+	if value != nil {
+		v = *value
+	}
+	if len(key) > int(d.meta.maxKeySize) {
+		return ErrKeyTooLarge
+	}
+	if len(v) > int(d.meta.maxValueSize) {
+		return ErrValueTooLarge
+	}
+
+	defer d.stack.Clear()
+	l, err := d.leafAndPathForKey(key, &d.stack)
+	if err != nil {
+		return err
+	}
+
+	idx, exists := lowerBoundBytesArr(l.keys, key)
+	if exists {
+		l.values[idx] = v
+		return d.writeNode(l)
+	}
+
+	l.insertAt(idx, key, v, nullPage)
+	d.meta.count++
+
+	n := l
+	for {
+		upKey, right, err := d.splitIfNeeded(n)
+		if err != nil || right == nil {
+			return d.finishMutation(err)
+		}
+
+		p, ok := d.stack.Pop()
+		if !ok {
+			// root was split
+			id, err := d.allocPage()
+			if err != nil {
+				return err
+			}
+			root := &diskNode{id: id, keys: []Bytes{upKey}, children: []pageID{n.id, right.id}}
+			d.meta.root = root.id
+			d.meta.height++
+			return d.finishMutation(d.writeNode(root))
+		}
+
+		p.node.insertAt(p.pos, upKey, nil, right.id)
+		n = p.node
+	}
+}
+
+// splitIfNeeded writes the node, splitting it first if it holds more keys than fit in a page.
+// It returns the key to be added to the parent and the new right node in case of a split.
+func (d *DiskBTree) splitIfNeeded(n *diskNode) (upKey Bytes, right *diskNode, err error) {
+	if (n.leaf && len(n.keys) <= d.maxLeafKeys()) || (!n.leaf && len(n.children) <= d.deg) {
+		return nil, nil, d.writeNode(n)
+	}
+
+	id, err := d.allocPage()
+	if err != nil {
+		return nil, nil, err
+	}
+	right = &diskNode{id: id, leaf: n.leaf}
+
+	if n.leaf {
+		size := len(n.keys) / 2
+		right.keys = append(right.keys, n.keys[size:]...)
+		right.values = append(right.values, n.values[size:]...)
+		n.keys, n.values = n.keys[:size], n.values[:size]
+		upKey = right.keys[0]
+
+		right.next, right.prev, n.next = n.next, n.id, right.id
+		if right.next != nullPage {
+			next, err := d.readNode(right.next)
+			if err != nil {
+				return nil, nil, err
+			}
+			next.prev = right.id
+			if err := d.writeNode(next); err != nil {
+				return nil, nil, err
+			}
+		}
+	} else {
+		size := d.minChildren()
+		upKey = n.keys[size-1]
+		right.keys = append(right.keys, n.keys[size:]...)
+		right.children = append(right.children, n.children[size:]...)
+		n.keys, n.children = n.keys[:size-1], n.children[:size]
+	}
+
+	if err := d.writeNode(n); err != nil {
+		return nil, nil, err
+	}
+	return upKey, right, d.writeNode(right)
+}
+
+func (d *DiskBTree) finishMutation(err error) error {
+	if err != nil {
+		return err
+	}
+	return d.writeMeta()
+}
+
+func (d *DiskBTree) DelOp(key Bytes) (bool, error) {
+	defer d.stack.Clear()
+	l, err := d.leafAndPathForKey(key, &d.stack)
+	if err != nil {
+		return false, err
+	}
+
+	idx, exists := lowerBoundBytesArr(l.keys, key)
+	if !exists {
+		return false, nil
+	}
+	l.keys = removeAt(l.keys, idx)
+	l.values = removeAt(l.values, idx)
+	d.meta.count--
+	if err := d.writeNode(l); err != nil {
+		return false, err
+	}
+
+	n := l
+	for !d.stack.Empty() && d.needsRebalance(n) {
+		p, _ := d.stack.Pop()
+		if err := d.rebalance(p.node, p.pos); err != nil {
+			return false, err
+		}
+		n = p.node
+	}
+
+	// the root is removed when it's left with a single child
+	if !n.leaf && d.stack.Empty() && len(n.children) == 1 {
+		d.meta.root = n.children[0]
+		d.meta.height--
+		if err := d.freePage(n.id); err != nil {
+			return false, err
+		}
+	}
+	return true, d.finishMutation(nil)
+}
+
+func (d *DiskBTree) needsRebalance(n *diskNode) bool {
+	if n.leaf {
+		return len(n.keys) < d.minLeafKeys()
+	}
+	return len(n.children) < d.minChildren()
+}
+
+// rebalance fixes the child at pos of parent by merging it with or borrowing from a sibling,
+// and writes all changed nodes
+func (d *DiskBTree) rebalance(parent *diskNode, pos int) error {
+	// choose the sibling with more keys, like InternalNode.siblingPair
+	li := pos
+	if pos == len(parent.children)-1 {
+		li = pos - 1
+	}
+	left, err := d.readNode(parent.children[li])
+	if err != nil {
+		return err
+	}
+	right, err := d.readNode(parent.children[li+1])
+	if err != nil {
+		return err
+	}
+	if li == pos && pos > 0 {
+		prev, err := d.readNode(parent.children[pos-1])
+		if err != nil {
+			return err
+		}
+		if len(prev.keys) >= len(right.keys) {
+			li, left, right = pos-1, prev, left
+		}
+	}
+
+	downKey := parent.keys[li]
+	keys := append(append([]Bytes(nil), left.keys...), right.keys...)
+	merge := len(keys) <= d.maxLeafKeys()
+	if !left.leaf {
+		keys = append(append(append([]Bytes(nil), left.keys...), downKey), right.keys...)
+		merge = len(left.children)+len(right.children) <= d.deg
+	}
+
+	if merge {
+		left.keys = keys
+		left.values = append(left.values, right.values...)
+		left.children = append(left.children, right.children...)
+		if left.leaf {
+			left.next = right.next
+			if left.next != nullPage {
+				next, err := d.readNode(left.next)
+				if err != nil {
+					return err
+				}
+				next.prev = left.id
+				if err := d.writeNode(next); err != nil {
+					return err
+				}
+			}
+		}
+
+		parent.keys = removeAt(parent.keys, li)
+		parent.children = removeAt(parent.children, li+1)
+		if err := d.freePage(right.id); err != nil {
+			return err
+		}
+	} else if left.leaf {
+		values := append(append([]Bytes(nil), left.values...), right.values...)
+		size := len(keys) / 2
+		left.keys, right.keys = keys[:size:size], keys[size:]
+		left.values, right.values = values[:size:size], values[size:]
+		parent.keys[li] = right.keys[0]
+	} else {
+		children := append(append([]pageID(nil), left.children...), right.children...)
+		size := len(children) / 2
+		left.children, right.children = children[:size:size], children[size:]
+		left.keys, right.keys = keys[:size-1:size-1], keys[size:]
+		parent.keys[li] = keys[size-1]
+	}
+
+	if !merge {
+		if err := d.writeNode(right); err != nil {
+			return err
+		}
+	}
+	if err := d.writeNode(left); err != nil {
+		return err
+	}
+	return d.writeNode(parent)
+}
+
+func (d *DiskBTree) baseIterator(low, high Bytes) iter.Seq2[Bytes, *Bytes] {
+	return func(yield func(Bytes, *Bytes) bool) {
+		leaf, err := d.leafAndPathForKey(low, nil)
+		if err != nil {
+			d.err = err
+			return
+		}
+		idx, _ := lowerBoundBytesArr(leaf.keys, low)
+
+		for {
+			for ; idx < len(leaf.keys); idx++ {
+				if high != nil && bytes.Compare(leaf.keys[idx], high) >= 0 {
+					return
+				}
+				if !yield(leaf.keys[idx], &leaf.values[idx]) {
+					return
+				}
+			}
+			if leaf.next == nullPage {
+				return
+			}
+			if leaf, err = d.readNode(leaf.next); err != nil {
+				d.err = err
+				return
+			}
+			idx = 0
+		}
+	}
+}
+
+// All iterates over all pairs in ascending key order. Errors stop the iteration and are reported by Err.
+// The tree must not be modified during iteration.
+func (d *DiskBTree) All() iter.Seq2[Bytes, *Bytes] {
+	return d.baseIterator(nil, nil)
+}
+
+// Range iterates over the pairs with keys in [low, high). Errors stop the iteration and are reported by Err.
+// The tree must not be modified during iteration.
+func (d *DiskBTree) Range(low, high Bytes) iter.Seq2[Bytes, *Bytes] {
+	return d.baseIterator(low, high)
+}
+
+// Err returns the first error that stopped an iteration
+func (d *DiskBTree) Err() error {
+	return d.err
+}
+
+// Sync writes all cached changes to the file and flushes it to stable storage
+func (d *DiskBTree) Sync() error {
+	return d.pool.flush()
+}
+
+func (d *DiskBTree) Close() error {
+	err := d.Sync()
+	return errors.Join(err, d.pager.close())
+}
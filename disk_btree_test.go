@@ -0,0 +1,239 @@
+package btree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// small pages and cache so that tests go through splits, merges and evictions with few keys
+var smallDiskOptions = DiskOptions{PageSize: 512, MaxKeySize: 32, MaxValueSize: 32, CachePages: 8}
+
+func openTestDiskTree(t *testing.T, path string) *DiskBTree {
+	t.Helper()
+	d, err := OpenDiskBTree(path, smallDiskOptions)
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	return d
+}
+
+func diskKeys(d *DiskBTree) []Bytes {
+	var keys []Bytes
+	for k := range d.All() {
+		keys = append(keys, slices.Clone(k))
+	}
+	return keys
+}
+
+func TestDiskSetGetAfterReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	d := openTestDiskTree(t, path)
+	keys, _ := GetData(3000)
+
+	for i := range keys {
+		v := Bytes(keys[i][8:])
+		if err := d.SetOp(keys[i][:], &v); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	d = openTestDiskTree(t, path)
+	defer d.Close()
+	for i := range keys {
+		v, err := d.GetOp(keys[i][:])
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		if v == nil || !bytes.Equal(*v, keys[i][8:]) {
+			t.Fatalf("wrong value for key %d", i)
+		}
+	}
+
+	slices.SortFunc(keys, func(a, b Hash) int {
+		return bytes.Compare(a[:], b[:])
+	})
+	got := diskKeys(d)
+	if len(got) != len(keys) {
+		t.Fatalf("expected %d keys, iterated over %d", len(keys), len(got))
+	}
+	for i := range got {
+		if !bytes.Equal(got[i], keys[i][:]) {
+			t.Fatalf("key %d out of order", i)
+		}
+	}
+	if d.Err() != nil {
+		t.Fatalf("iteration: %v", d.Err())
+	}
+}
+
+// an existing file must keep the page size it was created with, whatever the options it's reopened with
+func TestDiskReopenWithOtherOptions(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	d := openTestDiskTree(t, path)
+	keys, _ := GetData(3)
+	for i := range keys {
+		v := Bytes(keys[i][8:])
+		if err := d.SetOp(keys[i][:], &v); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	for _, opts := range []DiskOptions{{}, {PageSize: 64}} {
+		d, err := OpenDiskBTree(path, opts)
+		if err != nil {
+			t.Fatalf("open with %+v: %v", opts, err)
+		}
+		if d.Len() != len(keys) || d.Degree() != diskDegree(512, 32, 32) {
+			t.Fatalf("reopened with %+v: Len is %d and degree %d", opts, d.Len(), d.Degree())
+		}
+		for i := range keys {
+			v, err := d.GetOp(keys[i][:])
+			if err != nil || v == nil || !bytes.Equal(*v, keys[i][8:]) {
+				t.Fatalf("reopened with %+v: wrong value for key %d: %v", opts, i, err)
+			}
+		}
+		if err := d.Close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+	}
+}
+
+// a meta page with sizes that don't fit together must be reported instead of being used to size pages
+func TestDiskCorruptMeta(t *testing.T) {
+	for _, c := range []struct {
+		name   string
+		offset int
+		value  uint32
+	}{
+		{"zero page size", 8, 0},
+		{"huge page size", 8, 1 << 31},
+		{"small degree", 8 + 12, 2},
+		{"other degree", 8 + 12, uint32(diskDegree(512, 32, 32) + 1)},
+	} {
+		path := filepath.Join(t.TempDir(), "tree.db")
+		if err := openTestDiskTree(t, path).Close(); err != nil {
+			t.Fatalf("close: %v", err)
+		}
+		f, err := os.OpenFile(path, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := f.WriteAt(binary.LittleEndian.AppendUint32(nil, c.value), int64(c.offset)); err != nil {
+			t.Fatal(err)
+		}
+		if err := f.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := OpenDiskBTree(path, smallDiskOptions); !errors.Is(err, ErrCorrupt) {
+			t.Errorf("%s: expected ErrCorrupt, got %v", c.name, err)
+		}
+	}
+}
+
+func TestDiskDeleteReusesPages(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.db")
+	d := openTestDiskTree(t, path)
+	defer d.Close()
+	keys, _ := GetData(2000)
+
+	for i := range keys {
+		v := Bytes{byte(i)}
+		if err := d.SetOp(keys[i][:], &v); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+	}
+	pages := d.meta.numPages
+
+	rand.Shuffle(len(keys), func(i, j int) {
+		keys[i], keys[j] = keys[j], keys[i]
+	})
+	for _, key := range keys[:1900] {
+		del, err := d.DelOp(key[:])
+		if err != nil || !del {
+			t.Fatalf("delete: %v %v", del, err)
+		}
+	}
+	for _, key := range keys[:1900] {
+		if del, _ := d.DelOp(key[:]); del {
+			t.Fatalf("deleted key deleted again")
+		}
+		if v, _ := d.GetOp(key[:]); v != nil {
+			t.Fatalf("deleted key still has a value")
+		}
+	}
+	if got := len(diskKeys(d)); got != 100 || d.Len() != 100 {
+		t.Fatalf("expected 100 keys after deletes, got %d with Len %d", got, d.Len())
+	}
+	if d.meta.freeHead == nullPage {
+		t.Fatalf("merged pages weren't added to the free list")
+	}
+
+	// reinsertion must use freed pages instead of growing the file
+	for _, key := range keys[:1900] {
+		v := Bytes{1}
+		if err := d.SetOp(key[:], &v); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+	}
+	if d.meta.numPages > pages+pages/10 {
+		t.Errorf("file grew from %d to %d pages after reinsertion", pages, d.meta.numPages)
+	}
+	if got := len(diskKeys(d)); got != 2000 {
+		t.Fatalf("expected 2000 keys after reinsertion, got %d", got)
+	}
+}
+
+func TestDiskRange(t *testing.T) {
+	d := openTestDiskTree(t, filepath.Join(t.TempDir(), "tree.db"))
+	defer d.Close()
+	for i := range 500 {
+		k := Bytes{byte(i >> 8), byte(i)}
+		if err := d.SetOp(k, &k); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+	}
+
+	n := 0
+	for k, v := range d.Range(Bytes{0, 100}, Bytes{1, 100}) {
+		if !bytes.Equal(k, *v) {
+			t.Fatalf("wrong value for key %v", k)
+		}
+		n++
+	}
+	if n != 256 {
+		t.Errorf("expected 256 keys in range, got %d", n)
+	}
+}
+
+func TestDiskLimits(t *testing.T) {
+	d := openTestDiskTree(t, filepath.Join(t.TempDir(), "tree.db"))
+	defer d.Close()
+
+	big := make(Bytes, 33)
+	if err := d.SetOp(big, nil); !errors.Is(err, ErrKeyTooLarge) {
+		t.Errorf("expected ErrKeyTooLarge, got %v", err)
+	}
+	if err := d.SetOp(Bytes{1}, &big); !errors.Is(err, ErrValueTooLarge) {
+		t.Errorf("expected ErrValueTooLarge, got %v", err)
+	}
+
+	if _, err := OpenDiskBTree(filepath.Join(t.TempDir(), "small.db"), DiskOptions{PageSize: 64}); err == nil {
+		t.Errorf("expected error for pages too small to hold 3 keys")
+	}
+	if _, err := OpenDiskBTree(filepath.Join(t.TempDir(), "large.db"), DiskOptions{PageSize: MaxPageSize + 1}); err == nil {
+		t.Errorf("expected error for pages larger than MaxPageSize")
+	}
+}
@@ -0,0 +1,151 @@
+package btree
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+const (
+	pageTypeLeaf     byte = 1
+	pageTypeInternal byte = 2
+	pageTypeFree     byte = 3
+
+	leafHeaderSize     = 1 + 2 + 8 + 8 // type, number of keys, next, prev
+	internalHeaderSize = 1 + 2         // type, number of keys
+	lenPrefixSize      = 2             // length prefix of keys and values
+)
+
+var errCorruptPage = fmt.Errorf("%w: bad page", ErrCorrupt)
+
+// diskNode is the decoded form of a leaf or internal page. Leaf pages hold keys and values and
+// are linked to their neighbours, internal pages hold keys and child page ids.
+type diskNode struct {
+	id       pageID
+	leaf     bool
+	keys     []Bytes
+	values   []Bytes  // only for leaves
+	children []pageID // only for internal nodes
+	next     pageID   // only for leaves
+	prev     pageID   // only for leaves
+}
+
+// encode writes the node into buf, which must be at least as large as the encoded node
+func (n *diskNode) encode(buf []byte) []byte {
+	buf = buf[:0]
+	if n.leaf {
+		buf = append(buf, pageTypeLeaf)
+		buf = binary.LittleEndian.AppendUint16(buf, uint16(len(n.keys)))
+		buf = binary.LittleEndian.AppendUint64(buf, n.next)
+		buf = binary.LittleEndian.AppendUint64(buf, n.prev)
+		for i := range n.keys {
+			buf = appendLenPrefixed(buf, n.keys[i])
+			buf = appendLenPrefixed(buf, n.values[i])
+		}
+		return buf
+	}
+
+	buf = append(buf, pageTypeInternal)
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(n.keys)))
+	for _, c := range n.children {
+		buf = binary.LittleEndian.AppendUint64(buf, c)
+	}
+	for _, k := range n.keys {
+		buf = appendLenPrefixed(buf, k)
+	}
+	return buf
+}
+
+// decodeDiskNode decodes a page into a node. The node doesn't reference the page memory.
+func decodeDiskNode(id pageID, page []byte) (*diskNode, error) {
+	// one copy of the page backs all keys and values of the node
+	page = append([]byte(nil), page...)
+	n := &diskNode{id: id}
+
+	switch page[0] {
+	case pageTypeLeaf:
+		n.leaf = true
+		nKeys := int(binary.LittleEndian.Uint16(page[1:]))
+		n.next = binary.LittleEndian.Uint64(page[3:])
+		n.prev = binary.LittleEndian.Uint64(page[11:])
+		n.keys = make([]Bytes, 0, nKeys+1)
+		n.values = make([]Bytes, 0, nKeys+1)
+		rest := page[leafHeaderSize:]
+		for range nKeys {
+			var k, v Bytes
+			var ok bool
+			if k, rest, ok = readLenPrefixed(rest); !ok {
+				return nil, fmt.Errorf("%w: leaf %d", errCorruptPage, id)
+			}
+			if v, rest, ok = readLenPrefixed(rest); !ok {
+				return nil, fmt.Errorf("%w: leaf %d", errCorruptPage, id)
+			}
+			n.keys = append(n.keys, k)
+			n.values = append(n.values, v)
+		}
+
+	case pageTypeInternal:
+		nKeys := int(binary.LittleEndian.Uint16(page[1:]))
+		rest := page[internalHeaderSize:]
+		if len(rest) < (nKeys+1)*8 {
+			return nil, fmt.Errorf("%w: internal node %d", errCorruptPage, id)
+		}
+		n.children = make([]pageID, 0, nKeys+2)
+		for i := range nKeys + 1 {
+			n.children = append(n.children, binary.LittleEndian.Uint64(rest[i*8:]))
+		}
+		rest = rest[(nKeys+1)*8:]
+		n.keys = make([]Bytes, 0, nKeys+1)
+		for range nKeys {
+			var k Bytes
+			var ok bool
+			if k, rest, ok = readLenPrefixed(rest); !ok {
+				return nil, fmt.Errorf("%w: internal node %d", errCorruptPage, id)
+			}
+			n.keys = append(n.keys, k)
+		}
+
+	default:
+		return nil, fmt.Errorf("%w: page %d has type %d", errCorruptPage, id, page[0])
+	}
+	return n, nil
+}
+
+func appendLenPrefixed(buf []byte, b Bytes) []byte {
+	buf = binary.LittleEndian.AppendUint16(buf, uint16(len(b)))
+	return append(buf, b...)
+}
+
+func readLenPrefixed(buf []byte) (b Bytes, rest []byte, ok bool) {
+	if len(buf) < lenPrefixSize {
+		return nil, nil, false
+	}
+	n := int(binary.LittleEndian.Uint16(buf))
+	buf = buf[lenPrefixSize:]
+	if len(buf) < n {
+		return nil, nil, false
+	}
+	return buf[:n:n], buf[n:], true
+}
+
+// insertAt inserts the key (and value or child to its right) at index idx
+func (n *diskNode) insertAt(idx int, key Bytes, value Bytes, child pageID) {
+	n.keys = insertAt(n.keys, idx, key)
+	if n.leaf {
+		n.values = insertAt(n.values, idx, value)
+	} else {
+		n.children = insertAt(n.children, idx+1, child)
+	}
+}
+
+func insertAt[T any](arr []T, idx int, e T) []T {
+	var zero T
+	arr = append(arr, zero)
+	shrArr(arr[idx:], 1)
+	arr[idx] = e
+	return arr
+}
+
+func removeAt[T any](arr []T, idx int) []T {
+	shlArr(arr[idx:], 1)
+	return arr[:len(arr)-1]
+}
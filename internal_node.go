@@ -1,20 +1,29 @@
 package btree
 
 import (
-	"bytes"
+	"fmt"
 	"slices"
+	"sync/atomic"
 )
 
 type InternalNode[V any] struct {
 	keys     []Bytes
 	pointers []Node[V]
+	// counts[i] is the number of keys in the subtree under pointers[i]. They are int64 so that
+	// ConcurrentBTree can update them with atomic operations.
+	counts   []int64
 	minCount int
+	ctx      *treeContext
+	hash     atomic.Pointer[Hash] // cached digest, nil if it has to be recomputed
+	// prefix is shared by all separators when the tree compresses keys, see LeafNode.prefix and encodeKeys
+	prefix Bytes
 }
 
 func newInternalNode[V any](degree int) *InternalNode[V] {
 	return &InternalNode[V]{
 		keys:     make([]Bytes, 0, degree-1),
 		pointers: make([]Node[V], 0, degree),
+		counts:   make([]int64, 0, degree),
 		minCount: ceilDiv(degree, 2),
 	}
 }
@@ -25,6 +34,117 @@ func (t *InternalNode[V]) len() int {
 
 func (t *InternalNode[V]) isLeaf() bool { return false }
 
+func (t *InternalNode[V]) context() *treeContext { return t.ctx }
+
+func (t *InternalNode[V]) clone(ctx *treeContext) Node[V] {
+	c := newInternalNode[V](cap(t.pointers))
+	c.keys = append(c.keys, t.keys...)
+	c.pointers = append(c.pointers, t.pointers...)
+	c.counts = append(c.counts, t.counts...)
+	c.prefix = t.prefix
+	c.ctx = ctx
+	return c
+}
+
+// key returns the separator at index i, which is rebuilt from the prefix if the tree compresses keys
+func (t *InternalNode[V]) key(i int) Bytes {
+	if len(t.prefix) == 0 {
+		return t.keys[i]
+	}
+	k := make(Bytes, 0, len(t.prefix)+len(t.keys[i]))
+	return append(append(k, t.prefix...), t.keys[i]...)
+}
+
+// fullKeys returns the separators of the node, see key
+func (t *InternalNode[V]) fullKeys() []Bytes {
+	if len(t.prefix) == 0 {
+		return t.keys
+	}
+	keys := make([]Bytes, len(t.keys))
+	for i := range keys {
+		keys[i] = t.key(i)
+	}
+	return keys
+}
+
+// search returns the lower bound of key in the separators and whether it's equal to one of them
+func (t *InternalNode[V]) search(key Bytes) (int, bool) {
+	if len(t.prefix) == 0 {
+		return lowerBoundFunc(t.keys, key, t.ctx.comparator())
+	}
+	return prefixedLowerBound(t.prefix, t.keys, key)
+}
+
+// decodeKeys stores the separators in full, so that they can be modified like those of a node that
+// doesn't compress keys. encodeKeys must be called once the node is modified.
+func (t *InternalNode[V]) decodeKeys() {
+	if len(t.prefix) == 0 {
+		return
+	}
+	for i := range t.keys {
+		t.keys[i] = t.key(i)
+	}
+	t.prefix = nil
+}
+
+// encodeKeys stores the separators without their shared prefix if the tree compresses keys. The prefix and
+// the rest of each separator are copied to a single new slab, whose bytes are never modified afterward.
+func (t *InternalNode[V]) encodeKeys() {
+	if !t.ctx.compressesKeys() || len(t.keys) == 0 || len(t.prefix) > 0 {
+		return
+	}
+	first, last := t.keys[0], t.keys[len(t.keys)-1]
+	n := commonPrefixLen(first, last)
+	if n == 0 {
+		return
+	}
+	size := n
+	for _, k := range t.keys {
+		size += len(k) - n
+	}
+	slab := append(make([]byte, 0, size), first[:n]...)
+	for i, k := range t.keys {
+		start := len(slab)
+		slab = append(slab, k[n:]...)
+		t.keys[i] = slab[start:len(slab):len(slab)]
+	}
+	t.prefix = slab[:n:n]
+}
+
+// mutableChild returns pointers[i], first replacing it with a copy if it's shared with another tree
+func (t *InternalNode[V]) mutableChild(i int) Node[V] {
+	c := t.pointers[i]
+	if c.context() != t.ctx {
+		c = c.clone(t.ctx)
+		t.pointers[i] = c
+	}
+	c.invalidateDigest()
+	return c
+}
+
+func (t *InternalNode[V]) digest(encode func(v V) Bytes) Hash {
+	if d := t.hash.Load(); d != nil {
+		return *d
+	}
+	children := make([]Hash, t.len())
+	for i, p := range t.pointers {
+		children[i] = p.digest(encode)
+	}
+	d := internalDigest(t.fullKeys(), children)
+	t.hash.Store(&d)
+	return d
+}
+
+func (t *InternalNode[V]) invalidateDigest() { t.hash.Store(nil) }
+
+func (t *InternalNode[V]) size() int {
+	var total int64
+	for _, c := range t.counts {
+		total += c
+	}
+	return int(total)
+}
+
 func (t *InternalNode[V]) needsRebalance() bool {
 	return t.len() < t.minCount
 }
@@ -32,10 +152,16 @@ func (t *InternalNode[V]) needsRebalance() bool {
 func (t *InternalNode[V]) isHealthy() bool {
 	rebalNeeded := t.needsRebalance()
 	keyPtrLenCheck := len(t.keys) == t.len()-1
-	keysSorted := slices.IsSortedFunc(t.keys, func(a, b Bytes) int {
-		return bytes.Compare(a, b)
+	countsCorrect := len(t.counts) == t.len()
+	for i := 0; countsCorrect && i < t.len(); i++ {
+		countsCorrect = t.counts[i] == int64(t.pointers[i].size())
+	}
+	cmp := t.ctx.comparator()
+	keys := t.fullKeys()
+	keysSorted := slices.IsSortedFunc(keys, cmp)
+	keysUnique := !hasRepeatsFn(keys, func(a, b Bytes) bool {
+		return cmp(a, b) == 0
 	})
-	keysUnique := !hasRepeatsFn(t.keys, bytes.Equal)
 	ptrsUnique := true
 	s := NewSet[Node[V]]()
 	for _, p := range t.pointers {
@@ -45,7 +171,7 @@ func (t *InternalNode[V]) isHealthy() bool {
 		}
 	}
 
-	healthy := !rebalNeeded && keyPtrLenCheck && keysSorted && keysUnique && ptrsUnique
+	healthy := !rebalNeeded && keyPtrLenCheck && countsCorrect && keysSorted && keysUnique && ptrsUnique
 	return healthy
 }
 
@@ -87,44 +213,61 @@ func (t *InternalNode[V]) siblingPair(i int) (left Node[V], right Node[V], downK
 
 // Returns the index to t.pointers for the given key
 func (t *InternalNode[V]) childIndexForKey(key Bytes) int {
-	pos, exists := lowerBoundBytesArr(t.keys, key)
+	pos, exists := t.search(key)
 	if exists {
 		return pos + 1
 	}
 	return pos
 }
 
-func (t *InternalNode[V]) handleInsert(pos int, key Bytes, ptr Node[V]) (Bytes, Node[V]) {
+// handleInsert updates the node after an insertion in the subtree at pointers[pos].
+// inserted is false if the insertion only updated the value of an existing key.
+func (t *InternalNode[V]) handleInsert(pos int, key Bytes, ptr Node[V], inserted bool) (Bytes, Node[V], error) {
+	if len(t.counts) != t.len() {
+		return nil, nil, fmt.Errorf("%w: internal node has %d pointers and %d counts", ErrCorrupt, t.len(), len(t.counts))
+	}
 	if ptr == nil {
 		// No new child formed
-		return nil, nil
+		if inserted {
+			t.counts[pos]++
+		}
+		return nil, nil, nil
 	}
 
+	// child at pos was split, so its count has to be recomputed
+	t.counts[pos] = int64(t.pointers[pos].size())
+
+	t.decodeKeys()
+	defer t.encodeKeys()
 	// space available in node
 	if len(t.keys) < cap(t.keys) {
 		t.insertAtIndex(pos, key, ptr)
-		return nil, nil
+		return nil, nil, nil
 	}
 
 	// needs splitting
 	up, newNode := t.insertWithSplit(pos, key, ptr)
+	newNode.encodeKeys()
 
 	// In case, we directly return newNode, it won't return true for (newNode == nil) in the calling function
 	// [See https://go.dev/doc/faq#nil_error]
 	if newNode != nil {
-		return up, newNode
+		return up, newNode, nil
 	}
-	return up, nil
+	return up, nil, nil
 }
 
 func (t *InternalNode[V]) insertAtIndex(idx int, key Bytes, ptr Node[V]) {
 	sz := t.len()
 	t.keys = t.keys[:sz]
 	t.pointers = t.pointers[:sz+1]
+	t.counts = t.counts[:sz+1]
 	shrArr(t.keys[idx:], 1)
 	shrArr(t.pointers[idx+1:], 1)
+	shrArr(t.counts[idx+1:], 1)
 	t.keys[idx] = key
 	t.pointers[idx+1] = ptr
+	t.counts[idx+1] = int64(ptr.size())
 }
 
 func (t *InternalNode[V]) insertWithSplit(pos int, key Bytes, ptr Node[V]) (upKey Bytes, newNode *InternalNode[V]) {
@@ -136,6 +279,7 @@ func (t *InternalNode[V]) insertWithSplit(pos int, key Bytes, ptr Node[V]) (upKe
 	temp := newInternalNode[V](t.len() + 1)
 	temp.keys = append(temp.keys, t.keys...)
 	temp.pointers = append(temp.pointers, t.pointers...)
+	temp.counts = append(temp.counts, t.counts...)
 
 	temp.insertAtIndex(pos, key, ptr)
 	upKeyIdx := size - 1
@@ -145,44 +289,85 @@ func (t *InternalNode[V]) insertWithSplit(pos int, key Bytes, ptr Node[V]) (upKe
 	t.keys = t.keys[:upKeyIdx]
 	copy(t.pointers[:size], temp.pointers[:size])
 	t.pointers = t.pointers[:size]
+	copy(t.counts[:size], temp.counts[:size])
+	t.counts = t.counts[:size]
 
 	r := newInternalNode[V](cap(t.pointers))
+	r.ctx = t.ctx
 	r.keys = append(r.keys, temp.keys[upKeyIdx+1:]...)
 	r.pointers = append(r.pointers, temp.pointers[size:]...)
+	r.counts = append(r.counts, temp.counts[size:]...)
 
 	return upKey, r
 }
 
-func (t *InternalNode[V]) handleDelete(pos int, del bool) bool {
+// handleDelete updates the node after a deletion in the subtree at pointers[pos], and rebalances the
+// child if needed. It returns ErrCorrupt if the child can't be rebalanced.
+func (t *InternalNode[V]) handleDelete(pos int, del bool) (bool, error) {
 	if !del {
-		return del
+		return del, nil
+	}
+	if len(t.counts) != t.len() {
+		return false, fmt.Errorf("%w: internal node has %d pointers and %d counts", ErrCorrupt, t.len(), len(t.counts))
 	}
 
+	t.counts[pos]--
 	if t.pointers[pos].needsRebalance() {
-		left, right, dkIdx := t.siblingPair(pos)
-		upKey := left.rebalanceWith(right, t.keys[dkIdx])
-
-		if upKey != nil { // no nodes deleted, only strictly rebalanced
-			t.keys[dkIdx] = upKey
-		} else { // right node deleted
-			sz := t.len()
-			shlArr(t.keys[dkIdx:], 1)
-			shlArr(t.pointers[dkIdx+1:], 1)
-			t.pointers = t.pointers[:sz-1]
-			t.keys = t.keys[:sz-2]
+		if t.len() < 2 {
+			return false, fmt.Errorf("%w: internal node with a single pointer", ErrCorrupt)
+		}
+		dkIdx, merged, err := t.rebalanceChild(pos)
+		if err != nil {
+			return false, err
+		}
+		if t.pointers[dkIdx].needsRebalance() {
+			return false, fmt.Errorf("%w: left node underfull after rebalancing", ErrCorrupt)
 		}
+		if !merged && t.pointers[dkIdx+1].needsRebalance() {
+			return false, fmt.Errorf("%w: right node underfull after rebalancing", ErrCorrupt)
+		}
+	}
+	return del, nil
+}
 
-		lnr := left.needsRebalance()
-		rnr := right.needsRebalance()
-		assert(!lnr, "left needs rebalance")
-		assert(upKey == nil || !rnr, "right needs rebalance")
+// rebalanceChild rebalances the child at pos with one of its siblings, merging them if they fit in a node.
+// It returns the index of the left node of the pair, and whether the right node was merged into it.
+func (t *InternalNode[V]) rebalanceChild(pos int) (dkIdx int, merged bool, err error) {
+	_, _, dkIdx = t.siblingPair(pos)
+	// both nodes of the pair are modified, so neither can be shared with another tree
+	left, right := t.mutableChild(dkIdx), t.mutableChild(dkIdx+1)
+	t.decodeKeys()
+	defer t.encodeKeys()
+	upKey, err := left.rebalanceWith(right, t.keys[dkIdx])
+	if err != nil {
+		return dkIdx, false, err
 	}
-	return del
+
+	if upKey != nil { // no nodes deleted, only strictly rebalanced
+		t.keys[dkIdx] = upKey
+		t.counts[dkIdx+1] = int64(right.size())
+	} else { // right node deleted
+		sz := t.len()
+		shlArr(t.keys[dkIdx:], 1)
+		shlArr(t.pointers[dkIdx+1:], 1)
+		shlArr(t.counts[dkIdx+1:], 1)
+		t.pointers = t.pointers[:sz-1]
+		t.keys = t.keys[:sz-2]
+		t.counts = t.counts[:sz-1]
+	}
+	t.counts[dkIdx] = int64(left.size())
+	return dkIdx, upKey == nil, nil
 }
 
-func (t *InternalNode[V]) rebalanceWith(rightNode Node[V], downKey Bytes) Bytes {
-	// cast sibling as internal node type, will panic if it isn't
-	rNode := rightNode.(*InternalNode[V])
+func (t *InternalNode[V]) rebalanceWith(rightNode Node[V], downKey Bytes) (Bytes, error) {
+	rNode, ok := rightNode.(*InternalNode[V])
+	if !ok {
+		return nil, fmt.Errorf("%w: internal node rebalanced with a %T", ErrCorrupt, rightNode)
+	}
+
+	t.decodeKeys()
+	defer t.encodeKeys()
+	rNode.decodeKeys()
 
 	// if a single node can contain all the data
 	merge := t.len()+rNode.len() <= cap(t.pointers)
@@ -190,11 +375,13 @@ func (t *InternalNode[V]) rebalanceWith(rightNode Node[V], downKey Bytes) Bytes
 		t.keys = append(t.keys, downKey)
 		t.keys = append(t.keys, rNode.keys...)
 		t.pointers = append(t.pointers, rNode.pointers...)
-		return nil
+		t.counts = append(t.counts, rNode.counts...)
+		return nil, nil
 	}
 
 	upKey := redistributeInternalUnoptimized(t, rNode, downKey)
-	return upKey
+	rNode.encodeKeys()
+	return upKey, nil
 }
 
 func redistributeInternalUnoptimized[V any](l *InternalNode[V], r *InternalNode[V], downKey Bytes) (upKey Bytes) {
@@ -206,6 +393,8 @@ func redistributeInternalUnoptimized[V any](l *InternalNode[V], r *InternalNode[
 	temp.keys = append(temp.keys, r.keys...)
 	temp.pointers = append(temp.pointers, l.pointers...)
 	temp.pointers = append(temp.pointers, r.pointers...)
+	temp.counts = append(temp.counts, l.counts...)
+	temp.counts = append(temp.counts, r.counts...)
 
 	lsz := l.minCount // num pointers in l
 	rsz := totalLen - lsz
@@ -214,9 +403,13 @@ func redistributeInternalUnoptimized[V any](l *InternalNode[V], r *InternalNode[
 	l.pointers = l.pointers[:lsz]
 	r.keys = r.keys[:rsz-1]
 	r.pointers = r.pointers[:rsz]
+	l.counts = l.counts[:lsz]
+	r.counts = r.counts[:rsz]
 
 	copy(l.pointers, temp.pointers[:lsz])
 	copy(r.pointers, temp.pointers[lsz:])
+	copy(l.counts, temp.counts[:lsz])
+	copy(r.counts, temp.counts[lsz:])
 
 	copy(l.keys, temp.keys[:lsz-1]) // keys always one less than pointers
 	upKey = temp.keys[lsz-1]
@@ -10,26 +10,28 @@ import (
 	"testing"
 )
 
-func MakeInternalNode(deg int) *InternalNode[int] {
-	in := newInternalNode[int](deg)
+func MakeInternalNode(deg int) *InternalNode[*int] {
+	in := newInternalNode[*int](deg)
 
 	rv, lv := rand.Int(), rand.Int()
-	rightSentLeaf := &LeafNode[int]{
+	rightSentLeaf := &LeafNode[*int]{
 		keys:     []Bytes{{250}},
 		values:   []*int{&rv},
 		next:     nil,
 		minCount: 1,
 	}
 
-	leftSentLeaf := &LeafNode[int]{
+	leftSentLeaf := &LeafNode[*int]{
 		keys:     []Bytes{{5}},
 		values:   []*int{&lv},
 		next:     rightSentLeaf,
 		minCount: 1,
 	}
+	rightSentLeaf.prev = leftSentLeaf
 
 	in.keys = append(in.keys, Bytes{250})
 	in.pointers = append(in.pointers, leftSentLeaf, rightSentLeaf)
+	in.counts = append(in.counts, 1, 1)
 	return in
 }
 
@@ -44,13 +46,13 @@ func MakeKeysWithGaps(n int, gap int) []Bytes {
 	return keys
 }
 
-func MakeFilledNode() (*InternalNode[int], []Bytes) {
+func MakeFilledNode() (*InternalNode[*int], []Bytes) {
 	in := MakeInternalNode(30)
 	keys := MakeKeysWithGaps(28, 5)
-	st := NewStack[TraversalPositions[int]](2)
+	st := NewStack[TraversalPositions[*int]](2)
 	for i, key := range keys {
 		v := i*10 + 1
-		_, newNode := setOrInsert(in, key, &v, st)
+		_, newNode, _, _ := setOrInsert(in, key, &v, st)
 		if newNode != nil {
 			panic(fmt.Sprintf("possible test misconfiguration: at iter %d, more keys than can fit in single node", i))
 		}
@@ -75,14 +77,14 @@ func TestInternalKeysStaySingle(t *testing.T) {
 func TestInternalSortedKeys(t *testing.T) {
 	in := MakeInternalNode(30)
 	keys := MakeKeysWithGaps(20, 5)
-	st := NewStack[TraversalPositions[int]](2)
+	st := NewStack[TraversalPositions[*int]](2)
 	rand.Shuffle(len(keys), func(i, j int) {
 		keys[i], keys[j] = keys[j], keys[i]
 	})
 
 	for i, key := range keys {
 		v := i*10 + 1
-		_, newNode := setOrInsert(in, key, &v, st)
+		_, newNode, _, _ := setOrInsert(in, key, &v, st)
 		if newNode != nil {
 			panic(fmt.Sprintf("possible test misconfiguration: at iter %d, more keys than can fit in single node", i))
 		}
@@ -98,8 +100,8 @@ func TestInternalSortedKeys(t *testing.T) {
 func TestInternalCorrectValues(t *testing.T) {
 	in, keys := MakeFilledNode()
 	for i, key := range keys {
-		r := valueRef[int](in, key)
-		if r == nil {
+		r, ok := lookup(in, key)
+		if !ok || r == nil {
 			t.Errorf("prefilled key %v is nil", key)
 		}
 
@@ -110,7 +112,7 @@ func TestInternalCorrectValues(t *testing.T) {
 
 	// All the prefilled keys have only their first bytes filled, any Bytes with non-zero 2nd place will be new
 	h := sha256.Sum256([]byte("Test bytes"))
-	if r := valueRef[int](in, h[:]); r != nil {
+	if r, ok := lookup(in, h[:]); ok || r != nil {
 		t.Error("value for unadded key")
 	}
 }
@@ -134,10 +136,13 @@ func TestInternalSplit(t *testing.T) {
 		return bytes.Compare(a, b)
 	})
 
-	st := NewStack[TraversalPositions[int]](2)
+	st := NewStack[TraversalPositions[*int]](2)
 	v := rand.Int()
-	upKey, newNode := setOrInsert(in, testKey, &v, st)
-	node := newNode.(*InternalNode[int])
+	upKey, newNode, _, err := setOrInsert(in, testKey, &v, st)
+	if err != nil {
+		t.Fatalf("insert failed: %v", err)
+	}
+	node := newNode.(*InternalNode[*int])
 
 	lkn := len(in.keys)
 	rkn := len(node.keys)
@@ -0,0 +1,219 @@
+package btree
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"time"
+)
+
+var errShortKey = errors.New("btree: encoded key is too short")
+
+// KeyCodec encodes keys of type K as byte arrays whose bytewise order is the same as the order of the keys.
+// Encodings are self-delimiting, so that codecs can be combined into tuple codecs.
+type KeyCodec[K any] interface {
+	// Append appends the encoding of k to dst
+	Append(dst Bytes, k K) Bytes
+	// Decode decodes the key at the start of b and returns the number of bytes it took
+	Decode(b Bytes) (K, int, error)
+}
+
+type signed interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64
+}
+
+type unsigned interface {
+	~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+// IntCodec encodes signed integers in 8 bytes, big-endian with the sign bit flipped
+type IntCodec[T signed] struct{}
+
+func (IntCodec[T]) Append(dst Bytes, k T) Bytes {
+	return binary.BigEndian.AppendUint64(dst, uint64(k)^(1<<63))
+}
+
+func (IntCodec[T]) Decode(b Bytes) (T, int, error) {
+	if len(b) < 8 {
+		return 0, 0, errShortKey
+	}
+	return T(int64(binary.BigEndian.Uint64(b) ^ (1 << 63))), 8, nil
+}
+
+// UintCodec encodes unsigned integers in 8 bytes, big-endian
+type UintCodec[T unsigned] struct{}
+
+func (UintCodec[T]) Append(dst Bytes, k T) Bytes {
+	return binary.BigEndian.AppendUint64(dst, uint64(k))
+}
+
+func (UintCodec[T]) Decode(b Bytes) (T, int, error) {
+	if len(b) < 8 {
+		return 0, 0, errShortKey
+	}
+	return T(binary.BigEndian.Uint64(b)), 8, nil
+}
+
+// Float64Codec encodes floats in 8 bytes, so that negative numbers come before positive ones and
+// -0 before +0. NaNs with the sign bit set are the smallest keys and the others are the largest.
+type Float64Codec struct{}
+
+func (Float64Codec) Append(dst Bytes, k float64) Bytes {
+	bits := math.Float64bits(k)
+	if bits&(1<<63) != 0 {
+		bits = ^bits
+	} else {
+		bits |= 1 << 63
+	}
+	return binary.BigEndian.AppendUint64(dst, bits)
+}
+
+func (Float64Codec) Decode(b Bytes) (float64, int, error) {
+	if len(b) < 8 {
+		return 0, 0, errShortKey
+	}
+	bits := binary.BigEndian.Uint64(b)
+	if bits&(1<<63) != 0 {
+		bits &^= 1 << 63
+	} else {
+		bits = ^bits
+	}
+	return math.Float64frombits(bits), 8, nil
+}
+
+// StringCodec encodes strings with 0x00 bytes escaped as 0x00 0xFF, followed by the terminator 0x00 0x01.
+// The terminator is smaller than any escaped or regular byte, so a string comes before all its extensions.
+type StringCodec struct{}
+
+func (StringCodec) Append(dst Bytes, k string) Bytes {
+	return appendEscaped(dst, k)
+}
+
+func (StringCodec) Decode(b Bytes) (string, int, error) {
+	s, n, err := decodeEscaped(b)
+	return string(s), n, err
+}
+
+// BytesCodec encodes byte arrays the same way as StringCodec, for use in tuples
+type BytesCodec struct{}
+
+func (BytesCodec) Append(dst Bytes, k Bytes) Bytes {
+	return appendEscaped(dst, k)
+}
+
+func (BytesCodec) Decode(b Bytes) (Bytes, int, error) {
+	return decodeEscaped(b)
+}
+
+func appendEscaped[S string | Bytes](dst Bytes, s S) Bytes {
+	for i := 0; i < len(s); i++ {
+		dst = append(dst, s[i])
+		if s[i] == 0x00 {
+			dst = append(dst, 0xFF)
+		}
+	}
+	return append(dst, 0x00, 0x01)
+}
+
+func decodeEscaped(b Bytes) (Bytes, int, error) {
+	var out Bytes
+	for i := 0; i < len(b)-1; i++ {
+		if b[i] != 0x00 {
+			out = append(out, b[i])
+			continue
+		}
+		switch b[i+1] {
+		case 0x01:
+			if out == nil {
+				out = Bytes{}
+			}
+			return out, i + 2, nil
+		case 0xFF:
+			out = append(out, 0x00)
+			i++
+		default:
+			return nil, 0, errors.New("btree: bad escape sequence in encoded key")
+		}
+	}
+	return nil, 0, errShortKey
+}
+
+// TimeCodec encodes times with nanosecond precision as seconds since the Unix epoch (like IntCodec)
+// followed by 4 bytes of nanoseconds. Decoded times are in UTC, the location and monotonic clock
+// reading of encoded times are lost.
+type TimeCodec struct{}
+
+func (TimeCodec) Append(dst Bytes, k time.Time) Bytes {
+	dst = IntCodec[int64]{}.Append(dst, k.Unix())
+	return binary.BigEndian.AppendUint32(dst, uint32(k.Nanosecond()))
+}
+
+func (TimeCodec) Decode(b Bytes) (time.Time, int, error) {
+	if len(b) < 12 {
+		return time.Time{}, 0, errShortKey
+	}
+	sec, _, _ := IntCodec[int64]{}.Decode(b)
+	nsec := binary.BigEndian.Uint32(b[8:])
+	return time.Unix(sec, int64(nsec)).UTC(), 12, nil
+}
+
+type Tuple2[A, B any] struct {
+	First  A
+	Second B
+}
+
+// Tuple2Codec encodes pairs ordered by their first element and then by their second
+type Tuple2Codec[A, B any] struct {
+	First  KeyCodec[A]
+	Second KeyCodec[B]
+}
+
+func (c Tuple2Codec[A, B]) Append(dst Bytes, k Tuple2[A, B]) Bytes {
+	dst = c.First.Append(dst, k.First)
+	return c.Second.Append(dst, k.Second)
+}
+
+func (c Tuple2Codec[A, B]) Decode(b Bytes) (Tuple2[A, B], int, error) {
+	var t Tuple2[A, B]
+	a, n, err := c.First.Decode(b)
+	if err != nil {
+		return t, 0, err
+	}
+	s, m, err := c.Second.Decode(b[n:])
+	if err != nil {
+		return t, 0, err
+	}
+	return Tuple2[A, B]{a, s}, n + m, nil
+}
+
+type Tuple3[A, B, C any] struct {
+	First  A
+	Second B
+	Third  C
+}
+
+// Tuple3Codec encodes triples ordered by their first, second and then third elements
+type Tuple3Codec[A, B, C any] struct {
+	First  KeyCodec[A]
+	Second KeyCodec[B]
+	Third  KeyCodec[C]
+}
+
+func (c Tuple3Codec[A, B, C]) Append(dst Bytes, k Tuple3[A, B, C]) Bytes {
+	dst = c.First.Append(dst, k.First)
+	dst = c.Second.Append(dst, k.Second)
+	return c.Third.Append(dst, k.Third)
+}
+
+func (c Tuple3Codec[A, B, C]) Decode(b Bytes) (Tuple3[A, B, C], int, error) {
+	var t Tuple3[A, B, C]
+	p, n, err := Tuple2Codec[A, B]{c.First, c.Second}.Decode(b)
+	if err != nil {
+		return t, 0, err
+	}
+	third, m, err := c.Third.Decode(b[n:])
+	if err != nil {
+		return t, 0, err
+	}
+	return Tuple3[A, B, C]{p.First, p.Second, third}, n + m, nil
+}
@@ -0,0 +1,212 @@
+package btree
+
+import (
+	"bytes"
+	"cmp"
+	"errors"
+	"iter"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+	"time"
+)
+
+// checkCodecOrder checks that encodings of the sorted keys are sorted too and that they decode back to the keys
+func checkCodecOrder[K any](t *testing.T, codec KeyCodec[K], keys []K, compare func(a, b K) int, equal func(a, b K) bool) {
+	t.Helper()
+	slices.SortFunc(keys, compare)
+	var prev Bytes
+	for i, k := range keys {
+		enc := codec.Append(nil, k)
+		if i > 0 && bytes.Compare(prev, enc) > 0 {
+			t.Fatalf("encoding of %v sorts before encoding of %v", k, keys[i-1])
+		}
+		if i > 0 && compare(keys[i-1], k) == 0 && !bytes.Equal(prev, enc) {
+			t.Fatalf("equal keys %v and %v have different encodings", k, keys[i-1])
+		}
+		prev = enc
+
+		// trailing bytes must not be read
+		dec, n, err := codec.Decode(append(enc, 0xAB, 0x00))
+		if err != nil || n != len(enc) || !equal(dec, k) {
+			t.Fatalf("%v decoded as %v (%d of %d bytes, %v)", k, dec, n, len(enc), err)
+		}
+	}
+}
+
+func eq[K comparable](a, b K) bool { return a == b }
+
+func TestIntCodecs(t *testing.T) {
+	ints := []int64{math.MinInt64, math.MaxInt64, 0, -1, 1}
+	uints := []uint64{0, math.MaxUint64, 1 << 63, 1}
+	for range 1000 {
+		ints = append(ints, rand.Int63()-rand.Int63())
+		uints = append(uints, rand.Uint64())
+	}
+	checkCodecOrder(t, IntCodec[int64]{}, ints, cmp.Compare, eq)
+	checkCodecOrder(t, UintCodec[uint64]{}, uints, cmp.Compare, eq)
+	checkCodecOrder(t, IntCodec[int8]{}, []int8{-128, 127, 0, -1}, cmp.Compare, eq)
+}
+
+func TestFloat64Codec(t *testing.T) {
+	floats := []float64{math.Inf(-1), math.Inf(1), 0, -math.MaxFloat64, math.MaxFloat64, math.SmallestNonzeroFloat64, -math.SmallestNonzeroFloat64}
+	for range 1000 {
+		floats = append(floats, rand.NormFloat64()*math.Pow(10, float64(rand.Intn(40)-20)))
+	}
+	checkCodecOrder(t, Float64Codec{}, floats, cmp.Compare, eq)
+
+	neg, pos := Float64Codec{}.Append(nil, math.Copysign(0, -1)), Float64Codec{}.Append(nil, 0)
+	if bytes.Compare(neg, pos) >= 0 {
+		t.Errorf("-0 must sort before +0")
+	}
+	if v, _, _ := (Float64Codec{}).Decode(Float64Codec{}.Append(nil, math.NaN())); !math.IsNaN(v) {
+		t.Errorf("NaN not decoded as NaN")
+	}
+}
+
+func TestStringCodec(t *testing.T) {
+	strs := []string{"", "\x00", "\x00\x00", "\x00\x01", "a", "a\x00", "a\x00b", "a\x01", "ab", "\xff", "\xff\xff", "b"}
+	for range 500 {
+		b := make([]byte, rand.Intn(6))
+		for i := range b {
+			b[i] = []byte{0x00, 0x01, 0x7f, 0xfe, 0xff}[rand.Intn(5)]
+		}
+		strs = append(strs, string(b))
+	}
+	checkCodecOrder(t, StringCodec{}, strs, cmp.Compare, eq)
+
+	if _, _, err := (StringCodec{}).Decode(Bytes("abc")); err == nil {
+		t.Errorf("expected error for missing terminator")
+	}
+	if _, _, err := (StringCodec{}).Decode(Bytes{'a', 0x00, 0x05}); err == nil {
+		t.Errorf("expected error for bad escape")
+	}
+}
+
+func TestTimeCodec(t *testing.T) {
+	base := time.Date(2025, 3, 1, 12, 0, 0, 0, time.UTC)
+	times := []time.Time{time.Unix(0, 0), base.AddDate(-500, 0, 0), base.AddDate(500, 0, 0)}
+	for range 500 {
+		times = append(times, base.Add(time.Duration(rand.Int63n(1<<50)-1<<49)))
+	}
+	checkCodecOrder(t, TimeCodec{}, times, time.Time.Compare, time.Time.Equal)
+}
+
+func TestTupleCodec(t *testing.T) {
+	type tup = Tuple3[string, int64, float64]
+	codec := Tuple3Codec[string, int64, float64]{StringCodec{}, IntCodec[int64]{}, Float64Codec{}}
+	var tuples []tup
+	for range 1000 {
+		tuples = append(tuples, tup{
+			[]string{"", "a", "a\x00", "ab", "b"}[rand.Intn(5)],
+			rand.Int63n(10) - 5,
+			float64(rand.Intn(10)) - 4.5,
+		})
+	}
+	checkCodecOrder(t, codec, tuples, func(a, b tup) int {
+		return cmp.Or(cmp.Compare(a.First, b.First), cmp.Compare(a.Second, b.Second), cmp.Compare(a.Third, b.Third))
+	}, eq)
+}
+
+func TestOrderedMap(t *testing.T) {
+	m := NewOrderedMap[int64, int](4, IntCodec[int64]{}, 4)
+	for i := int64(-500); i < 500; i++ {
+		v := int(i * 2)
+		m.Set(i, &v)
+	}
+	if del, _ := m.Del(0); !del || m.Get(0) != nil {
+		t.Fatalf("delete failed")
+	}
+	if v := m.Get(-7); v == nil || *v != -14 {
+		t.Fatalf("wrong value for -7")
+	}
+
+	var keys []int64
+	for k, v := range m.All() {
+		if *v != int(k*2) {
+			t.Fatalf("wrong value for key %d", k)
+		}
+		keys = append(keys, k)
+	}
+	if len(keys) != 999 || !slices.IsSorted(keys) || keys[0] != -500 {
+		t.Fatalf("keys not iterated in order")
+	}
+
+	var rng []int64
+	for k := range m.Range(-3, 3) {
+		rng = append(rng, k)
+	}
+	if !slices.Equal(rng, []int64{-3, -2, -1, 1, 2}) {
+		t.Fatalf("got range %v", rng)
+	}
+
+	rng = rng[:0]
+	for k := range m.Backward(-3, 3) {
+		rng = append(rng, k)
+	}
+	if !slices.Equal(rng, []int64{2, 1, -1, -2, -3}) {
+		t.Fatalf("got backward range %v", rng)
+	}
+}
+
+func TestOrderedMapBounds(t *testing.T) {
+	m := NewOrderedMap[int64, int](4, IntCodec[int64]{}, 4)
+	for i := int64(-50); i < 50; i++ {
+		v := int(i)
+		if err := m.Set(i, &v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	collect := func(seq iter.Seq2[int64, *int]) []int64 {
+		var keys []int64
+		for k := range seq {
+			keys = append(keys, k)
+		}
+		return keys
+	}
+	if got := collect(m.RangeBounds(UnboundedKey[int64](), ExcludedKey[int64](-47))); !slices.Equal(got, []int64{-50, -49, -48}) {
+		t.Fatalf("got range %v", got)
+	}
+	if got := collect(m.RangeBounds(ExcludedKey[int64](47), UnboundedKey[int64]())); !slices.Equal(got, []int64{48, 49}) {
+		t.Fatalf("got range %v", got)
+	}
+	if got := collect(m.BackwardBounds(IncludedKey[int64](-1), IncludedKey[int64](1))); !slices.Equal(got, []int64{1, 0, -1}) {
+		t.Fatalf("got backward range %v", got)
+	}
+	if n := len(collect(m.RangeBounds(UnboundedKey[int64](), UnboundedKey[int64]()))); n != m.Len() {
+		t.Fatalf("unbounded range has %d keys, expected %d", n, m.Len())
+	}
+}
+
+// brokenCodec can't decode the encoding of bad
+type brokenCodec struct {
+	IntCodec[int64]
+	bad int64
+}
+
+func (c brokenCodec) Decode(b Bytes) (int64, int, error) {
+	k, n, err := c.IntCodec.Decode(b)
+	if err == nil && k == c.bad {
+		return 0, 0, errors.New("can't decode")
+	}
+	return k, n, err
+}
+
+// A key that can't be decoded must stop the iteration and be reported by Err instead of panicking
+func TestOrderedMapDecodeError(t *testing.T) {
+	m := NewOrderedMap[int64, int](4, brokenCodec{bad: 5}, 4)
+	for i := range int64(10) {
+		if err := m.Set(i, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	n := 0
+	for range m.All() {
+		n++
+	}
+	if n != 5 || m.Err() == nil {
+		t.Fatalf("iterated over %d keys with error %v", n, m.Err())
+	}
+}
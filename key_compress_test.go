@@ -0,0 +1,110 @@
+package btree
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+// tenantKeys returns keys with long shared prefixes, and a few shorter keys that are prefixes of others
+func tenantKeys(n int) []Bytes {
+	keys := []Bytes{Bytes("t"), Bytes("tenant-0001"), Bytes("tenant-0002/"), {}}
+	for i := range n {
+		keys = append(keys, fmt.Appendf(nil, "tenant-%04d/user-%06d/item", i%7, i))
+	}
+	return keys
+}
+
+func newCompressedTree(t *testing.T, degree int) *BTree[int] {
+	return must[*BTree[int]](t)(New(Options[int]{Degree: degree, CompressKeys: true}))
+}
+
+func TestCompressKeysSavesMemory(t *testing.T) {
+	c := newCompressedTree(t, 16)
+	p, err := New(Options[int]{Degree: 16, CopyKeys: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, k := range tenantKeys(5000) {
+		c.SetOp(k, &i)
+		p.SetOp(k, &i)
+	}
+	cs, ps := c.Stats(), p.Stats()
+	if cs.KeyBytes != ps.KeyBytes {
+		t.Fatalf("key bytes differ: %d and %d", cs.KeyBytes, ps.KeyBytes)
+	}
+	if cs.HeapBytes >= ps.HeapBytes {
+		t.Fatalf("compressed tree uses %d bytes, uncompressed %d", cs.HeapBytes, ps.HeapBytes)
+	}
+}
+
+// Separators must be the shortest prefixes of keys that separate the leaves if the tree compresses keys,
+// and the first keys of the leaves otherwise, so that the RootHash of other trees doesn't change
+func TestSeparatorsAreShortened(t *testing.T) {
+	b, plain := newCompressedTree(t, 8), NewBTree[int](8, 4)
+	keys := tenantKeys(1000)
+	for i, k := range keys {
+		b.SetOp(k, &i)
+		plain.SetOp(k, &i)
+	}
+	for _, tree := range []*BTree[int]{b, plain} {
+		levels := treeLevels(tree.root)
+		for _, n := range levels[len(levels)-2] {
+			in := n.(*InternalNode[*int])
+			for i, sep := range in.fullKeys() {
+				last := in.pointers[i].(*LeafNode[*int]).fullKeys()
+				first := in.pointers[i+1].(*LeafNode[*int]).key(0)
+				shortened := len(sep) == commonPrefixLen(last[len(last)-1], sep)+1
+				if tree == b && !shortened || tree == plain && !bytes.Equal(sep, first) {
+					t.Fatalf("separator %q between %q and %q", sep, last[len(last)-1], first)
+				}
+			}
+		}
+		if err := tree.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Internal nodes must store their separators without the prefix they share
+func TestCompressKeysInternalNodes(t *testing.T) {
+	b := newCompressedTree(t, 8)
+	for i, k := range tenantKeys(3000) {
+		b.SetOp(k, &i)
+	}
+	compressed := 0
+	for _, level := range treeLevels(b.root) {
+		for _, n := range level {
+			in, ok := n.(*InternalNode[*int])
+			if !ok || len(in.prefix) == 0 {
+				continue
+			}
+			compressed++
+			for i, k := range in.keys {
+				if full := in.key(i); !bytes.HasPrefix(full, in.prefix) || len(full) != len(in.prefix)+len(k) {
+					t.Fatalf("separator %q isn't stored without the prefix %q", full, in.prefix)
+				}
+			}
+		}
+	}
+	if compressed == 0 {
+		t.Fatal("no internal node has a prefix")
+	}
+}
+
+// Iterating over a tree with compressed keys allocates each key once
+func TestCompressKeysIterationAllocs(t *testing.T) {
+	b := newCompressedTree(t, 16)
+	keys := tenantKeys(200)
+	for i, k := range keys {
+		b.SetOp(k, &i)
+	}
+	allocs := testing.AllocsPerRun(10, func() {
+		for range b.All() {
+		}
+	})
+	// the cursor, the closure and its path are allocated once per iteration
+	if limit := float64(len(keys) + 8); allocs > limit {
+		t.Fatalf("%v allocations to iterate over %d keys", allocs, len(keys))
+	}
+}
@@ -0,0 +1,56 @@
+package btree
+
+import (
+	"bytes"
+	"testing"
+	"unsafe"
+)
+
+// Keys returned by the tree must not share capacity, so that appending to one can't change another
+func TestCopyKeysAppendToReturnedKey(t *testing.T) {
+	b := must[*BTree[int]](t)(New(Options[int]{Degree: 4, CopyKeys: true}))
+	for i := range 100 {
+		b.SetOp(Bytes{byte(i)}, &i)
+	}
+	for k := range b.All() {
+		_ = append(k, 0xff)
+	}
+	i := 0
+	for k := range b.All() {
+		if !bytes.Equal(k, Bytes{byte(i)}) {
+			t.Fatalf("key %d changed to %v", i, k)
+		}
+		i++
+	}
+}
+
+func inSlab(slab []byte, k Bytes) bool {
+	if len(k) == 0 {
+		return true
+	}
+	start := uintptr(unsafe.Pointer(unsafe.SliceData(slab)))
+	p := uintptr(unsafe.Pointer(&k[0]))
+	return p >= start && p+uintptr(len(k)) <= start+uintptr(len(slab))
+}
+
+// Merging leaves must move all keys to the slab of the merged leaf
+func TestCopyKeysCompactOnMerge(t *testing.T) {
+	ctx := &treeContext{copyKeys: true}
+	l, r := newLeafNode[*int](8), newLeafNode[*int](8)
+	l.ctx, r.ctx = ctx, ctx
+	for i := range 3 {
+		l.setOrInsert(Bytes{byte(i), 1, 2, 3}, &i)
+		r.setOrInsert(Bytes{byte(i + 10), 1, 2, 3}, &i)
+	}
+	if up, _ := l.rebalanceWith(r, nil); up != nil {
+		t.Fatalf("leaves weren't merged")
+	}
+	if l.len() != 6 || len(l.slab) != 6*4 {
+		t.Fatalf("merged leaf has %d keys in %d bytes of slab", l.len(), len(l.slab))
+	}
+	for _, k := range l.keys {
+		if !inSlab(l.slab, k) {
+			t.Fatalf("key %v is not in the slab of the merged leaf", k)
+		}
+	}
+}
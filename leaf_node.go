@@ -2,20 +2,29 @@ package btree
 
 import (
 	"bytes"
+	"fmt"
 	"slices"
+	"sync/atomic"
 )
 
 type LeafNode[V any] struct {
 	keys     []Bytes
-	values   []*V
+	values   []V
 	next     *LeafNode[V] // points to the leaf to its right
+	prev     *LeafNode[V] // points to the leaf to its left
 	minCount int
+	ctx      *treeContext
+	hash     atomic.Pointer[Hash] // cached digest, nil if it has to be recomputed
+	slab     []byte               // memory of the keys copied by the leaf, see storeKey
+	// prefix is shared by all keys when the tree compresses keys, keys then only hold the rest of each key.
+	// It's empty otherwise, use key and fullKeys to read keys.
+	prefix Bytes
 }
 
 func newLeafNode[V any](nKeys int) *LeafNode[V] {
 	return &LeafNode[V]{
 		keys:     make([]Bytes, 0, nKeys),
-		values:   make([]*V, 0, nKeys),
+		values:   make([]V, 0, nKeys),
 		next:     nil,
 		minCount: ceilDiv(nKeys, 2),
 	}
@@ -25,6 +34,10 @@ func (l *LeafNode[V]) Next() *LeafNode[V] {
 	return l.next
 }
 
+func (l *LeafNode[V]) Prev() *LeafNode[V] {
+	return l.prev
+}
+
 func (l *LeafNode[V]) len() int {
 	return len(l.keys)
 }
@@ -33,6 +46,41 @@ func (l *LeafNode[V]) isLeaf() bool {
 	return true
 }
 
+func (l *LeafNode[V]) context() *treeContext { return l.ctx }
+
+// clone copies the leaf for ctx. Links between leaves are only maintained between leaves of the same
+// context, as updating the links of a shared leaf would modify the tree that shares it.
+func (l *LeafNode[V]) clone(ctx *treeContext) Node[V] {
+	c := newLeafNode[V](cap(l.keys))
+	c.keys = append(c.keys, l.keys...)
+	c.values = append(c.values, l.values...)
+	c.prefix = l.prefix
+	c.next, c.prev = l.next, l.prev
+	c.ctx = ctx
+	if c.next != nil && c.next.ctx == ctx {
+		c.next.prev = c
+	}
+	if c.prev != nil && c.prev.ctx == ctx {
+		c.prev.next = c
+	}
+	return c
+}
+
+func (l *LeafNode[V]) digest(encode func(v V) Bytes) Hash {
+	if d := l.hash.Load(); d != nil {
+		return *d
+	}
+	d := leafDigest(l.fullKeys(), encodeValues(l.values, encode))
+	l.hash.Store(&d)
+	return d
+}
+
+func (l *LeafNode[V]) invalidateDigest() { l.hash.Store(nil) }
+
+func (l *LeafNode[V]) size() int {
+	return l.len()
+}
+
 func (l *LeafNode[V]) needsRebalance() bool {
 	return l.len() < l.minCount
 }
@@ -40,13 +88,18 @@ func (l *LeafNode[V]) needsRebalance() bool {
 func (l *LeafNode[V]) isHealthy() bool {
 	rebalNeeded := l.needsRebalance()
 	keyValLenMatch := l.len() == len(l.values)
-	keysSorted := slices.IsSortedFunc(l.keys, func(a, b Bytes) int {
-		return bytes.Compare(a, b)
+	cmp := l.ctx.comparator()
+	keysSorted := slices.IsSortedFunc(l.keys, cmp)
+	keysUnique := !hasRepeatsFn(l.keys, func(a, b Bytes) bool {
+		return cmp(a, b) == 0
 	})
-	keysUnique := !hasRepeatsFn(l.keys, bytes.Equal)
-	nextIsCorrect := l.next == nil || bytes.Compare(l.keys[l.len()-1], l.next.keys[0]) == -1
+	// links to leaves of other contexts aren't maintained
+	nextIsCorrect := l.next == nil || l.next.ctx != l.ctx ||
+		(cmp(l.key(l.len()-1), l.next.key(0)) < 0 && l.next.prev == l)
+	prevIsCorrect := l.prev == nil || l.prev.ctx != l.ctx ||
+		(cmp(l.prev.key(l.prev.len()-1), l.key(0)) < 0 && l.prev.next == l)
 
-	healthy := !rebalNeeded && keyValLenMatch && keysSorted && keysUnique && nextIsCorrect
+	healthy := !rebalNeeded && keyValLenMatch && keysSorted && keysUnique && nextIsCorrect && prevIsCorrect
 	return healthy
 }
 
@@ -54,34 +107,161 @@ func (l *LeafNode[V]) numUnhealthyChildren() (unhealthy int, total int) {
 	return 0, 0
 }
 
-func (l *LeafNode[V]) pairAt(idx int) (Bytes, *V) {
+func (l *LeafNode[V]) pairAt(idx int) (Bytes, V) {
 	if idx >= l.len() {
-		return nil, nil
+		var zero V
+		return nil, zero
+	}
+	return l.key(idx), l.values[idx]
+}
+
+// key returns the key at index i, which is rebuilt from the prefix if the leaf compresses keys
+func (l *LeafNode[V]) key(i int) Bytes {
+	if len(l.prefix) == 0 {
+		return l.keys[i]
 	}
-	return l.keys[idx], l.values[idx]
+	k := make(Bytes, 0, len(l.prefix)+len(l.keys[i]))
+	return append(append(k, l.prefix...), l.keys[i]...)
 }
 
-func (l *LeafNode[V]) setOrInsert(key Bytes, value *V) (Bytes, Node[V]) {
-	idx, _ := lowerBoundBytesArr(l.keys, key)
+// fullKeys returns the keys of the leaf, see key
+func (l *LeafNode[V]) fullKeys() []Bytes {
+	if len(l.prefix) == 0 {
+		return l.keys
+	}
+	keys := make([]Bytes, l.len())
+	for i := range keys {
+		keys[i] = l.key(i)
+	}
+	return keys
+}
+
+// search returns the lower bound of key in the leaf and whether the key exists
+func (l *LeafNode[V]) search(key Bytes) (int, bool) {
+	if len(l.prefix) == 0 {
+		return lowerBoundFunc(l.keys, key, l.ctx.comparator())
+	}
+	return prefixedLowerBound(l.prefix, l.keys, key)
+}
+
+// setOrInsert sets the value of key, inserted is false if the key already existed and only its value was updated
+func (l *LeafNode[V]) setOrInsert(key Bytes, value V) (upKey Bytes, newNode Node[V], inserted bool) {
+	idx, exists := l.search(key)
 
 	// Key already exists in tree
-	if idx < l.len() && bytes.Equal(l.keys[idx], key) {
+	if exists {
 		l.values[idx] = value
-		return nil, nil
+		return nil, nil, false
 	}
 
+	key = l.storeKey(key)
 	// Key doesn't exist but leaf has available space
 	if l.len() < cap(l.keys) {
 		l.insertAtIndex(idx, key, value)
-		return nil, nil
+		return nil, nil, true
 	}
 
 	// Leaf needs to be split for insertion; insertWithSplit doesn't return nil in any case
 	node := l.insertWithSplit(idx, key, value)
-	return node.keys[0], node
+	return l.separator(l.key(l.len()-1), node.key(0)), node, true
 }
 
-func (l *LeafNode[V]) insertAtIndex(idx int, key Bytes, value *V) {
+// minSlabSize is the smallest slab allocated by a leaf that copies keys
+const minSlabSize = 64
+
+// storeKey returns the key to store in the leaf. If the tree copies keys, that's a copy of key appended
+// to the slab of the leaf, without the prefix if the leaf compresses keys. Otherwise it's key itself.
+// Bytes written to a slab are never modified, as keys can be shared with clones, separators and callers.
+// When a slab is full, or key doesn't start with the prefix, the keys are compacted into a new slab.
+func (l *LeafNode[V]) storeKey(key Bytes) Bytes {
+	if !l.ctx.copiesKeys() {
+		return key
+	}
+	if !bytes.HasPrefix(key, l.prefix) || len(l.slab)+len(key)-len(l.prefix) > cap(l.slab) {
+		l.compactSlab(key)
+	}
+	start := len(l.slab)
+	l.slab = append(l.slab, key[len(l.prefix):]...)
+	// the capacity is limited so that appending to a key can't overwrite the next one
+	return l.slab[start:len(l.slab):len(l.slab)]
+}
+
+// compactSlab copies the keys of the leaf to a new slab with room for pending, a key about to be stored or
+// nil, dropping the bytes of keys that were deleted or moved to other leaves. If the leaf compresses keys,
+// the prefix becomes the longest one shared by the keys and pending.
+func (l *LeafNode[V]) compactSlab(pending Bytes) {
+	prefix := l.prefix
+	if l.ctx.compressesKeys() {
+		switch {
+		case l.len() > 0:
+			first, last := l.keys[0], l.keys[l.len()-1]
+			prefix = append(l.prefix[:len(l.prefix):len(l.prefix)], first[:commonPrefixLen(first, last)]...)
+			if pending != nil {
+				prefix = prefix[:commonPrefixLen(prefix, pending)]
+			}
+		case pending != nil:
+			prefix = pending
+		}
+	}
+	l.encodeKeys(prefix, len(pending))
+}
+
+// encodeKeys moves the keys of the leaf to a new slab with room for extra more bytes, storing them without
+// prefix, which they must all start with
+func (l *LeafNode[V]) encodeKeys(prefix Bytes, extra int) {
+	size := len(prefix) + extra
+	for _, k := range l.keys {
+		size += len(l.prefix) + len(k) - len(prefix)
+	}
+	slab := make([]byte, 0, max(2*size, minSlabSize))
+	slab = append(slab, prefix...)
+	newPrefix := slab[:len(prefix):len(prefix)]
+	for i, k := range l.keys {
+		start := len(slab)
+		if len(prefix) <= len(l.prefix) {
+			slab = append(append(slab, l.prefix[len(prefix):]...), k...)
+		} else {
+			slab = append(slab, k[len(prefix)-len(l.prefix):]...)
+		}
+		l.keys[i] = slab[start:len(slab):len(slab)]
+	}
+	l.prefix, l.slab = newPrefix, slab
+}
+
+// shareSlabPrefix re-encodes the leaves to their common prefix if they compress keys, so that their
+// keys can be moved between them
+func shareSlabPrefix[V any](l, r *LeafNode[V]) {
+	if !l.ctx.compressesKeys() || bytes.Equal(l.prefix, r.prefix) {
+		return
+	}
+	prefix := l.prefix[:commonPrefixLen(l.prefix, r.prefix)]
+	if len(prefix) < len(l.prefix) {
+		l.encodeKeys(prefix, 0)
+	}
+	if len(prefix) < len(r.prefix) {
+		r.encodeKeys(prefix, 0)
+	}
+}
+
+// separator returns the separator between leaves ending with the key left and starting with the key
+// right. If the tree compresses keys, that's the shortest prefix of right that is larger than left, which
+// makes internal nodes smaller and faster to search, otherwise it's right. Separators are part of the
+// digests of internal nodes, so shortening them only when asked for keeps the RootHash of other trees.
+// If the tree copies keys it's a copy, so that the separator doesn't keep the slab of the leaf alive
+// after it is compacted.
+func (l *LeafNode[V]) separator(left, right Bytes) Bytes {
+	sep := right
+	if l.ctx.compressesKeys() {
+		n := commonPrefixLen(left, right) + 1
+		sep = right[:n:n]
+	}
+	if l.ctx.copiesKeys() {
+		return append(Bytes{}, sep...)
+	}
+	return sep
+}
+
+func (l *LeafNode[V]) insertAtIndex(idx int, key Bytes, value V) {
 	sz := l.len()
 	l.keys = l.keys[:sz+1]
 	l.values = l.values[:sz+1]
@@ -91,10 +271,16 @@ func (l *LeafNode[V]) insertAtIndex(idx int, key Bytes, value *V) {
 	l.keys[idx], l.values[idx] = key, value
 }
 
-func (l *LeafNode[V]) insertWithSplit(idx int, key Bytes, value *V) *LeafNode[V] {
+func (l *LeafNode[V]) insertWithSplit(idx int, key Bytes, value V) *LeafNode[V] {
 	size := l.minCount               // number of keys to keep in the old node
 	r := newLeafNode[V](cap(l.keys)) // new right node
+	r.ctx = l.ctx
+	r.prefix = l.prefix
 	r.next = l.next
+	r.prev = l
+	if r.next != nil && r.next.ctx == r.ctx {
+		r.next.prev = r
+	}
 	l.next = r
 
 	// determine if key would be in the old or new node, and its index in that node
@@ -115,14 +301,19 @@ func (l *LeafNode[V]) insertWithSplit(idx int, key Bytes, value *V) *LeafNode[V]
 
 	// insert new key and value in the correct node
 	keyLeaf.insertAtIndex(idx, key, value)
+	if l.ctx.compressesKeys() {
+		// the halves can have longer prefixes
+		l.compactSlab(nil)
+		r.compactSlab(nil)
+	}
 	return r
 }
 
 func (l *LeafNode[V]) delete(key Bytes) bool {
-	i, _ := lowerBoundBytesArr(l.keys, key)
+	i, exists := l.search(key)
 
 	// key found
-	if i < l.len() && bytes.Equal(l.keys[i], key) {
+	if exists {
 		sz := l.len()
 		shlArr(l.keys[i:], 1)
 		shlArr(l.values[i:], 1)
@@ -134,21 +325,34 @@ func (l *LeafNode[V]) delete(key Bytes) bool {
 	return false
 }
 
-func (l *LeafNode[V]) rebalanceWith(rightNode Node[V], _ Bytes) Bytes {
-	// cast sibling as leaf node type, will panic if it isn't
-	rLeaf := rightNode.(*LeafNode[V])
+func (l *LeafNode[V]) rebalanceWith(rightNode Node[V], _ Bytes) (Bytes, error) {
+	rLeaf, ok := rightNode.(*LeafNode[V])
+	if !ok {
+		return nil, fmt.Errorf("%w: leaf rebalanced with a %T", ErrCorrupt, rightNode)
+	}
 
+	shareSlabPrefix(l, rLeaf)
 	// if a single node can contain all the data
 	merge := cap(l.keys) >= l.len()+rLeaf.len()
 	if merge {
 		l.keys = append(l.keys, rLeaf.keys...)
 		l.values = append(l.values, rLeaf.values...)
 		l.next = rLeaf.next
-		return nil
+		if l.next != nil && l.next.ctx == l.ctx {
+			l.next.prev = l
+		}
+		if l.ctx.copiesKeys() {
+			l.compactSlab(nil)
+		}
+		return nil, nil
 	}
 
 	redistributeLeafUnoptimized(l, rLeaf)
-	return rLeaf.keys[0]
+	if l.ctx.compressesKeys() {
+		l.compactSlab(nil)
+		rLeaf.compactSlab(nil)
+	}
+	return l.separator(l.key(l.len()-1), rLeaf.key(0)), nil
 }
 
 func redistributeLeafUnoptimized[V any](l *LeafNode[V], r *LeafNode[V]) {
@@ -14,7 +14,7 @@ func isSorted[V any](ln *LeafNode[V]) bool {
 }
 
 func TestLeafSorted(t *testing.T) {
-	ln := newLeafNode[int](5)
+	ln := newLeafNode[*int](5)
 	keys, values := GetData(5)
 
 	for i := 0; i < 5; i++ {
@@ -26,7 +26,7 @@ func TestLeafSorted(t *testing.T) {
 	}
 }
 
-func valueRefLeaf(l *LeafNode[int], key Bytes) *int {
+func valueRefLeaf(l *LeafNode[*int], key Bytes) *int {
 	i, _ := lowerBoundBytesArr(l.keys, key)
 	if i < l.len() && bytes.Equal(l.keys[i], key) {
 		return l.values[i]
@@ -36,13 +36,16 @@ func valueRefLeaf(l *LeafNode[int], key Bytes) *int {
 
 func TestLeafValues(t *testing.T) {
 	n := 5
-	ln := newLeafNode[int](n)
+	ln := newLeafNode[*int](n)
 	keys, values := GetData(n)
 	for i := 0; i < 5; i++ {
-		_, p := ln.setOrInsert(keys[i][:], &values[i])
+		_, p, inserted := ln.setOrInsert(keys[i][:], &values[i])
 		if p != nil {
 			t.Error("undesired splitting")
 		}
+		if !inserted {
+			t.Error("new key not reported as inserted")
+		}
 	}
 
 	for i := 0; i < 5; i++ {
@@ -54,21 +57,21 @@ func TestLeafValues(t *testing.T) {
 
 func TestLeafSplit(t *testing.T) {
 	n := 5
-	ln := newLeafNode[int](n)
+	ln := newLeafNode[*int](n)
 	keys, values := GetData(n + 1)
 
-	var node Node[int]
+	var node Node[*int]
 	for i := 0; i < n+1; i++ {
-		_, node = ln.setOrInsert(keys[i][:], &values[i])
+		_, node, _ = ln.setOrInsert(keys[i][:], &values[i])
 		if node != nil && i != n {
 			t.Error("split at incorrect position")
 		}
 	}
 
 	// TODO undetected error here, only showed up few times, error:
-	// panic: interface conversion: btree.Node[int] is nil, not *btree.LeafNode[int] [recovered]
-	//	panic: interface conversion: btree.Node[int] is nil, not *btree.LeafNode[int]
-	rnode := node.(*LeafNode[int])
+	// panic: interface conversion: btree.Node[*int] is nil, not *btree.LeafNode[*int] [recovered]
+	//	panic: interface conversion: btree.Node[*int] is nil, not *btree.LeafNode[*int]
+	rnode := node.(*LeafNode[*int])
 
 	if !isSorted(ln) {
 		t.Error("left split keys not sorted")
@@ -92,7 +95,7 @@ func TestLeafSplit(t *testing.T) {
 }
 
 func TestLeafUpdate(t *testing.T) {
-	ln := newLeafNode[int](5)
+	ln := newLeafNode[*int](5)
 	keys, values := GetData(5)
 	for i := 0; i < 5; i++ {
 		ln.setOrInsert(keys[i][:], &values[i])
@@ -107,7 +110,9 @@ func TestLeafUpdate(t *testing.T) {
 		t.Error("old value is incorrect")
 	}
 
-	ln.setOrInsert(keys[idx][:], &newVal)
+	if _, _, inserted := ln.setOrInsert(keys[idx][:], &newVal); inserted {
+		t.Error("update reported as insertion")
+	}
 	if r := valueRefLeaf(ln, key[:]); r == nil || *r != newVal {
 		t.Error("new value is incorrect")
 	}
@@ -13,9 +13,9 @@ func NewMap[K any, V any](degree int, hashFn func(K) Hash, expectedHeight int) *
 	}
 }
 
-func (m Map[K, V]) Set(key K, v *V) {
+func (m Map[K, V]) Set(key K, v *V) error {
 	h := m.hashFn(key)
-	m.SetOp(h[:], v)
+	return m.SetOp(h[:], v)
 }
 
 func (m Map[K, V]) Get(key K) *V {
@@ -24,7 +24,7 @@ func (m Map[K, V]) Get(key K) *V {
 	return v
 }
 
-func (m Map[K, V]) Del(key K) bool {
+func (m Map[K, V]) Del(key K) (bool, error) {
 	h := m.hashFn(key)
 	return m.DelOp(h[:])
 }
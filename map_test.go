@@ -58,6 +58,10 @@ func runMapHealthTests[V any](t *testing.T, m *Map[Hash, V], nKeys int, fail boo
 		fn("unhealthy children ratio = %d/%d", un, to)
 		return false
 	}
+	if err := m.Validate(); err != nil {
+		fn("%v", err)
+		return false
+	}
 
 	return true
 }
@@ -139,9 +143,9 @@ func TestMapDelete(t *testing.T) {
 
 	// try deleting
 	for i, key := range delKeys {
-		del := m.Del(key)
-		if !del {
-			t.Fatalf("deletion failed")
+		del, err := m.Del(key)
+		if !del || err != nil {
+			t.Fatalf("deletion failed: %v", err)
 		}
 		if !runMapHealthTests(t, m, nKeys-i-1, true) {
 			t.Fatalf("iteration: %d resulted in unhealthy map", i)
@@ -150,7 +154,7 @@ func TestMapDelete(t *testing.T) {
 
 	// check if deleted keys return false on further deletion and nil values on get op
 	for _, key := range delKeys {
-		del := m.Del(key)
+		del, _ := m.Del(key)
 		if del {
 			t.Fatalf("deleted keys returning true on m.Del")
 		}
@@ -171,9 +175,9 @@ func TestMapDelete(t *testing.T) {
 
 	// Delete all and check height
 	for _, key := range keys[delKeysLen:] {
-		del := m.Del(key)
-		if !del {
-			t.Fatalf("deletion failed")
+		del, err := m.Del(key)
+		if !del || err != nil {
+			t.Fatalf("deletion failed: %v", err)
 		}
 	}
 
@@ -0,0 +1,201 @@
+package btree
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash"
+	"slices"
+)
+
+var ErrInvalidProof = errors.New("btree: invalid proof")
+
+// ValueEncoder appends the canonical encoding of a non-nil value to dst. It is used to hash values,
+// so equal values must have the same encoding.
+type ValueEncoder[V any] func(dst []byte, v *V) []byte
+
+// defaultEncodeValue encodes Bytes and string values as they are, and other values in the %v format
+func defaultEncodeValue[V any](dst []byte, v *V) []byte {
+	switch x := any(v).(type) {
+	case *Bytes:
+		return append(dst, *x...)
+	case *string:
+		return append(dst, *x...)
+	}
+	return fmt.Append(dst, *v)
+}
+
+// NewHashedBTree returns a tree that hashes values with encodeValue, see RootHash
+func NewHashedBTree[V any](degree int, expectedHeight int, encodeValue ValueEncoder[V]) *BTree[V] {
+	b := NewBTree[V](degree, expectedHeight)
+	b.encodeValue = encodeValue
+	return b
+}
+
+// RootHash returns the SHA-256 digest of the tree, which commits to all pairs in the tree as well as its shape.
+// The digest of a leaf covers its keys and encoded values, and the digest of an internal node covers its
+// keys and the digests of its children. Digests are cached in the nodes and recomputed only for nodes
+// modified since the last call, so values must not be modified in place after being set.
+//
+// Values are encoded with the encoder of NewHashedBTree, or if there is none, Bytes and string values
+// are used as they are and other values are formatted with %v.
+func (b *BTree[V]) RootHash() Hash {
+	return b.root.digest(b.valueEncoder())
+}
+
+// valueEncoder returns the encoding of values in digests, which is nil for nil values
+func (b *BTree[V]) valueEncoder() func(*V) Bytes {
+	encode := b.encodeValue
+	if encode == nil {
+		encode = defaultEncodeValue[V]
+	}
+	return func(v *V) Bytes {
+		if v == nil {
+			return nil
+		}
+		return encode(Bytes{}, v)
+	}
+}
+
+// Proof shows that a key is or isn't in the tree with a given root hash. It holds the contents of the
+// nodes on the path from the root to the leaf where the key is or would be.
+type Proof struct {
+	Path   []ProofStep // internal nodes on the path, starting at the root
+	Keys   []Bytes     // keys of the leaf
+	Values []Bytes     // encoded values of the leaf, nil for nil values
+}
+
+// ProofStep is an internal node in a Proof
+type ProofStep struct {
+	Keys     []Bytes
+	Children []Hash // digests of the children
+}
+
+// Prove returns a proof that key is in the tree or that it isn't, which can be checked against RootHash
+// with VerifyProof, or with VerifyProofFunc for trees with a custom comparator.
+func (b *BTree[V]) Prove(key Bytes) *Proof {
+	encode := b.valueEncoder()
+	p := &Proof{}
+
+	n := b.root
+	for !n.isLeaf() {
+		ni := n.(*InternalNode[*V])
+		step := ProofStep{Keys: slices.Clone(ni.fullKeys()), Children: make([]Hash, ni.len())}
+		for i, c := range ni.pointers {
+			step.Children[i] = c.digest(encode)
+		}
+		p.Path = append(p.Path, step)
+		n = ni.pointers[ni.childIndexForKey(key)]
+	}
+
+	l := n.(*LeafNode[*V])
+	p.Keys = slices.Clone(l.fullKeys())
+	p.Values = encodeValues(l.values, encode)
+	return p
+}
+
+// VerifyProof checks a proof returned by Prove for key against the root hash of a tree. If the proof is
+// valid, it returns the encoded value of key and whether the key is in the tree, otherwise it returns
+// an error wrapping ErrInvalidProof.
+func VerifyProof(root Hash, key Bytes, p *Proof) (value Bytes, found bool, err error) {
+	return VerifyProofFunc(root, key, p, nil)
+}
+
+// VerifyProofFunc is VerifyProof for trees that order keys with cmp, see NewBTreeFunc
+func VerifyProofFunc(root Hash, key Bytes, p *Proof, cmp Comparator) (value Bytes, found bool, err error) {
+	if cmp == nil {
+		cmp = bytes.Compare
+	}
+	if len(p.Keys) != len(p.Values) {
+		return nil, false, fmt.Errorf("%w: leaf has %d keys and %d values", ErrInvalidProof, len(p.Keys), len(p.Values))
+	}
+
+	// the path must lead to the leaf where key would be
+	idx := make([]int, len(p.Path))
+	for i, step := range p.Path {
+		if len(step.Children) != len(step.Keys)+1 {
+			return nil, false, fmt.Errorf("%w: node at depth %d has %d keys and %d children",
+				ErrInvalidProof, i, len(step.Keys), len(step.Children))
+		}
+		pos, exists := lowerBoundFunc(step.Keys, key, cmp)
+		if exists {
+			pos++
+		}
+		idx[i] = pos
+	}
+
+	d := leafDigest(p.Keys, p.Values)
+	for i := len(p.Path) - 1; i >= 0; i-- {
+		step := p.Path[i]
+		if step.Children[idx[i]] != d {
+			return nil, false, fmt.Errorf("%w: digest mismatch at depth %d", ErrInvalidProof, i+1)
+		}
+		d = internalDigest(step.Keys, step.Children)
+	}
+	if d != root {
+		return nil, false, fmt.Errorf("%w: digest mismatch at the root", ErrInvalidProof)
+	}
+
+	for i, k := range p.Keys {
+		if cmp(k, key) == 0 {
+			return p.Values[i], true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// encodeValues encodes values for hashing
+func encodeValues[V any](values []V, encode func(V) Bytes) []Bytes {
+	enc := make([]Bytes, len(values))
+	for i, v := range values {
+		enc[i] = encode(v)
+	}
+	return enc
+}
+
+// Digests of leaves and internal nodes start with different bytes, so that one can't be passed as the other
+const (
+	leafDigestPrefix     = 0x00
+	internalDigestPrefix = 0x01
+)
+
+func leafDigest(keys []Bytes, values []Bytes) Hash {
+	h := sha256.New()
+	h.Write([]byte{leafDigestPrefix})
+	writeUvarint(h, uint64(len(keys)))
+	for i, k := range keys {
+		writeLenPrefixed(h, k)
+		if values[i] == nil {
+			h.Write([]byte{0})
+		} else {
+			h.Write([]byte{1})
+			writeLenPrefixed(h, values[i])
+		}
+	}
+	return Hash(h.Sum(nil))
+}
+
+func internalDigest(keys []Bytes, children []Hash) Hash {
+	h := sha256.New()
+	h.Write([]byte{internalDigestPrefix})
+	writeUvarint(h, uint64(len(children)))
+	for i, c := range children {
+		if i > 0 {
+			writeLenPrefixed(h, keys[i-1])
+		}
+		h.Write(c[:])
+	}
+	return Hash(h.Sum(nil))
+}
+
+func writeUvarint(h hash.Hash, x uint64) {
+	var buf [binary.MaxVarintLen64]byte
+	h.Write(binary.AppendUvarint(buf[:0], x))
+}
+
+func writeLenPrefixed(h hash.Hash, b Bytes) {
+	writeUvarint(h, uint64(len(b)))
+	h.Write(b)
+}
@@ -0,0 +1,171 @@
+package btree
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func encodeInt(dst []byte, v *int) []byte {
+	return binary.BigEndian.AppendUint64(dst, uint64(*v))
+}
+
+// Cached digests must be invalidated by every modification, so a tree hashed after every operation
+// must have the same root hash as one that is hashed only at the end
+func TestRootHashCaching(t *testing.T) {
+	keys, values := GetData(3000)
+	a := NewHashedBTree[int](4, 4, encodeInt)
+	b := NewHashedBTree[int](4, 4, encodeInt)
+	for i := range 10000 {
+		k := keys[rand.Intn(len(keys))][:]
+		switch rand.Intn(3) {
+		case 0, 1:
+			v := values[i%len(values)]
+			a.SetOp(k, &v)
+			b.SetOp(k, &v)
+		case 2:
+			a.DelOp(k)
+			b.DelOp(k)
+		}
+		if i%7 == 0 {
+			a.RootHash()
+		}
+	}
+	if a.RootHash() != b.RootHash() {
+		t.Fatalf("root hashes differ")
+	}
+
+	// updating a value changes the root hash, and restoring it restores the hash
+	before := a.RootHash()
+	k, v := a.Select(a.root.size() / 2)
+	old, other := *v, *v+1
+	a.SetOp(k, &other)
+	if a.RootHash() == before {
+		t.Fatalf("root hash didn't change after an update")
+	}
+	a.SetOp(k, &old)
+	if a.RootHash() != before {
+		t.Fatalf("root hash didn't return to its value")
+	}
+}
+
+func TestRootHashClone(t *testing.T) {
+	keys, values := GetData(2000)
+	a := NewHashedBTree[int](5, 4, encodeInt)
+	for i := range keys {
+		a.SetOp(keys[i][:], &values[i])
+	}
+	h := a.RootHash()
+
+	b := a.Clone()
+	if b.RootHash() != h {
+		t.Fatalf("clone has a different root hash")
+	}
+	for i := range keys[:500] {
+		b.DelOp(keys[i][:])
+	}
+	if a.RootHash() != h {
+		t.Fatalf("modifying the clone changed the root hash of the original")
+	}
+	if b.RootHash() == h {
+		t.Fatalf("root hash of the clone didn't change")
+	}
+}
+
+func TestProofs(t *testing.T) {
+	keys, values := GetData(3000)
+	b := NewHashedBTree[int](4, 4, encodeInt)
+	for i := range keys[:2000] {
+		b.SetOp(keys[i][:], &values[i])
+	}
+	root := b.RootHash()
+
+	for i := range keys {
+		p := b.Prove(keys[i][:])
+		v, found, err := VerifyProof(root, keys[i][:], p)
+		if err != nil {
+			t.Fatalf("valid proof for key %d rejected: %v", i, err)
+		}
+		if found != (i < 2000) {
+			t.Fatalf("key %d: found = %v", i, found)
+		}
+		if found && string(v) != string(encodeInt(nil, &values[i])) {
+			t.Fatalf("key %d: wrong value", i)
+		}
+	}
+
+	// a proof for one key can't be used for another key in a different leaf
+	p := b.Prove(keys[0][:])
+	for i := range keys {
+		if q := b.Prove(keys[i][:]); bytes.Equal(q.Keys[0], p.Keys[0]) {
+			continue // same leaf
+		}
+		if _, _, err := VerifyProof(root, keys[i][:], p); !errors.Is(err, ErrInvalidProof) {
+			t.Fatalf("proof of key 0 accepted for key %d", i)
+		}
+	}
+
+	// tampered proofs are rejected
+	p = b.Prove(keys[1][:])
+	p.Values[0] = append(p.Values[0], 1)
+	if _, _, err := VerifyProof(root, keys[1][:], p); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("proof with modified value accepted")
+	}
+	p = b.Prove(keys[1][:])
+	p.Path[0].Keys[0] = keys[2500][:]
+	if _, _, err := VerifyProof(root, keys[1][:], p); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("proof with modified separator accepted")
+	}
+	p = b.Prove(keys[1][:])
+	if _, _, err := VerifyProof(Hash{}, keys[1][:], p); !errors.Is(err, ErrInvalidProof) {
+		t.Fatalf("proof accepted for the wrong root")
+	}
+}
+
+func TestProofEmptyTree(t *testing.T) {
+	b := NewBTree[string](4, 4)
+	_, found, err := VerifyProof(b.RootHash(), Bytes("a"), b.Prove(Bytes("a")))
+	if err != nil || found {
+		t.Fatalf("found = %v, err = %v", found, err)
+	}
+
+	v := "x"
+	b.SetOp(Bytes("a"), &v)
+	b.SetOp(Bytes("b"), nil)
+	val, found, err := VerifyProof(b.RootHash(), Bytes("a"), b.Prove(Bytes("a")))
+	if err != nil || !found || string(val) != "x" {
+		t.Fatalf("got %q, %v, %v", val, found, err)
+	}
+	val, found, err = VerifyProof(b.RootHash(), Bytes("b"), b.Prove(Bytes("b")))
+	if err != nil || !found || val != nil {
+		t.Fatalf("got %q, %v, %v for a nil value", val, found, err)
+	}
+}
+
+// Concurrent readers hashing the same tree must not race, run with -race
+func TestRootHashConcurrent(t *testing.T) {
+	c := NewConcurrentBTree[int](4, 4)
+	keys, values := GetData(2000)
+	for i := range keys {
+		c.SetOp(keys[i][:], &values[i])
+	}
+
+	var wg sync.WaitGroup
+	hashes := make([]Hash, 4)
+	for r := range hashes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			hashes[r] = c.RootHash()
+		}()
+	}
+	wg.Wait()
+	for _, h := range hashes[1:] {
+		if h != hashes[0] {
+			t.Fatalf("concurrent root hashes differ")
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package btree
+
+import (
+	"bytes"
+	"fmt"
+	"iter"
+	"maps"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// must returns a function that fails the test if a constructor or a set operation returned an error
+func must[T any](t *testing.T) func(T, error) T {
+	return func(v T, err error) T {
+		t.Helper()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+}
+
+// modelTree is the part of the trees that TestModel compares against a map
+type modelTree interface {
+	set(key Bytes, v int) error
+	del(key Bytes) (bool, error)
+	get(key Bytes) (int, bool)
+	pairs(lo, hi Bounds, backward bool) iter.Seq2[Bytes, int]
+	fork() modelTree
+	Len() int
+	Validate() error
+}
+
+type pointerModel struct{ *BTree[int] }
+
+func (m pointerModel) set(key Bytes, v int) error  { return m.SetOp(key, &v) }
+func (m pointerModel) del(key Bytes) (bool, error) { return m.DelOp(key) }
+func (m pointerModel) fork() modelTree             { return pointerModel{m.Clone()} }
+
+func (m pointerModel) get(key Bytes) (int, bool) {
+	if v := m.GetOp(key); v != nil {
+		return *v, true
+	}
+	return 0, false
+}
+
+func (m pointerModel) pairs(lo, hi Bounds, backward bool) iter.Seq2[Bytes, int] {
+	seq := m.RangeBounds(lo, hi)
+	if backward {
+		seq = m.BackwardBounds(lo, hi)
+	}
+	return func(yield func(Bytes, int) bool) {
+		for k, v := range seq {
+			if !yield(k, *v) {
+				return
+			}
+		}
+	}
+}
+
+type valueModel struct{ *ValueBTree[int] }
+
+func (m valueModel) set(key Bytes, v int) error  { return m.Set(key, v) }
+func (m valueModel) del(key Bytes) (bool, error) { return m.Del(key) }
+func (m valueModel) get(key Bytes) (int, bool)   { return m.Get(key) }
+func (m valueModel) fork() modelTree             { return valueModel{m.Clone()} }
+
+func (m valueModel) pairs(lo, hi Bounds, backward bool) iter.Seq2[Bytes, int] {
+	if backward {
+		return m.BackwardBounds(lo, hi)
+	}
+	return m.RangeBounds(lo, hi)
+}
+
+// setModel holds keys only, the value of every key is 0
+type setModel struct{ *BTreeSet }
+
+func (m setModel) set(key Bytes, _ int) error {
+	_, err := m.Add(key)
+	return err
+}
+
+func (m setModel) del(key Bytes) (bool, error) { return m.Remove(key) }
+func (m setModel) get(key Bytes) (int, bool)   { return 0, m.Contains(key) }
+func (m setModel) fork() modelTree             { return setModel{m.Clone()} }
+
+func (m setModel) pairs(lo, hi Bounds, backward bool) iter.Seq2[Bytes, int] {
+	seq := m.RangeBounds(lo, hi)
+	if backward {
+		seq = m.BackwardBounds(lo, hi)
+	}
+	return func(yield func(Bytes, int) bool) {
+		for k := range seq {
+			if !yield(k, 0) {
+				return
+			}
+		}
+	}
+}
+
+var modelVariants = []struct {
+	name     string
+	keysOnly bool // values aren't stored, see setModel
+	copies   bool // inserted keys are copied, so their buffers can be reused
+	new      func(degree int) (modelTree, error)
+}{
+	{"plain", false, false, func(degree int) (modelTree, error) {
+		return pointerModel{NewBTree[int](degree, 4)}, nil
+	}},
+	{"copy keys", false, true, func(degree int) (modelTree, error) {
+		b, err := New(Options[int]{Degree: degree, CopyKeys: true})
+		return pointerModel{b}, err
+	}},
+	{"compress keys", false, true, func(degree int) (modelTree, error) {
+		b, err := New(Options[int]{Degree: degree, CompressKeys: true})
+		return pointerModel{b}, err
+	}},
+	{"value", false, false, func(degree int) (modelTree, error) {
+		b, err := NewValueBTree[int](degree, 4)
+		return valueModel{b}, err
+	}},
+	{"set", true, false, func(degree int) (modelTree, error) {
+		s, err := NewBTreeSet(degree, 4)
+		return setModel{s}, err
+	}},
+}
+
+// Every tree variant must hold the same pairs as a map after random operations, yield them in order for
+// any bounds in both directions, and be left as it was by modifications of its clones
+func TestModel(t *testing.T) {
+	keys := tenantKeys(1500)
+	for _, variant := range modelVariants {
+		for _, degree := range []int{3, 4, 9, 32} {
+			t.Run(fmt.Sprintf("%s/%d", variant.name, degree), func(t *testing.T) {
+				tree := must[modelTree](t)(variant.new(degree))
+				value := func(v int) int {
+					if variant.keysOnly {
+						return 0
+					}
+					return v
+				}
+
+				want := map[string]int{}
+				buf := make(Bytes, 0, 64)
+				for range 6000 {
+					k := keys[rand.Intn(len(keys))]
+					if rand.Intn(3) == 0 {
+						_, exists := want[string(k)]
+						if del, err := tree.del(k); err != nil || del != exists {
+							t.Fatalf("del returned %v %v, key existed: %v", del, err, exists)
+						}
+						delete(want, string(k))
+						continue
+					}
+					// trees that copy keys must not keep the buffer of an inserted key
+					key := k
+					if variant.copies {
+						key = append(buf[:0], k...)
+					}
+					v := value(rand.Intn(3)) // mostly zero values
+					if err := tree.set(key, v); err != nil {
+						t.Fatal(err)
+					}
+					clear(buf[:cap(buf)])
+					want[string(k)] = v
+				}
+				checkModel(t, tree, want, keys)
+
+				c, cwant := tree.fork(), maps.Clone(want)
+				for i, k := range keys[:500] {
+					x := append(Bytes("x"), k...)
+					if err := c.set(x, value(i)); err != nil {
+						t.Fatal(err)
+					}
+					cwant[string(x)] = value(i)
+					if _, err := c.del(k); err != nil {
+						t.Fatal(err)
+					}
+					delete(cwant, string(k))
+				}
+				checkModel(t, c, cwant, keys)
+				checkModel(t, tree, want, keys)
+			})
+		}
+	}
+}
+
+// checkModel checks that tree is valid and holds exactly the pairs of want, with lookups of keys and
+// with iterations over random bounds
+func checkModel(t *testing.T, tree modelTree, want map[string]int, keys []Bytes) {
+	t.Helper()
+	if err := tree.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Len() != len(want) {
+		t.Fatalf("Len is %d, expected %d", tree.Len(), len(want))
+	}
+	for _, k := range keys {
+		v, ok := tree.get(k)
+		wv, wok := want[string(k)]
+		if v != wv || ok != wok {
+			t.Fatalf("get(%q) returned %d %v, expected %d %v", k, v, ok, wv, wok)
+		}
+	}
+
+	sorted := make([]Bytes, 0, len(want))
+	for k := range want {
+		sorted = append(sorted, Bytes(k))
+	}
+	slices.SortFunc(sorted, bytes.Compare)
+	cmp := Comparator(bytes.Compare)
+	for i := range 100 {
+		lo, hi := Unbounded(), Unbounded()
+		if i > 0 && len(sorted) > 0 {
+			lo, hi = randomBounds(sorted), randomBounds(sorted)
+		}
+		var exp []Bytes
+		for _, k := range sorted {
+			if lo.admitsAbove(k, cmp) && hi.admitsBelow(k, cmp) {
+				exp = append(exp, k)
+			}
+		}
+		for _, backward := range []bool{false, true} {
+			var got []Bytes
+			for k, v := range tree.pairs(lo, hi, backward) {
+				if wv, ok := want[string(k)]; !ok || v != wv {
+					t.Fatalf("unexpected pair %q %d", k, v)
+				}
+				got = append(got, k)
+			}
+			if backward {
+				slices.Reverse(got)
+			}
+			if !slices.EqualFunc(got, exp, bytes.Equal) {
+				t.Fatalf("%v..%v, backward %v: got %d keys, expected %d", lo, hi, backward, len(got), len(exp))
+			}
+		}
+	}
+}
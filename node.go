@@ -14,11 +14,60 @@ type Node[V any] interface {
 	// rebalanceWith rebalances a node with another of the same type.
 	// Must be always called using the leftmost node in the pair.
 	// upkey is the new key fpr the rightmost node in node-sibling pair, if nil, it means node is right node is deleted
-	rebalanceWith(sibling Node[V], downKey Bytes) (upKey Bytes)
+	// It returns ErrCorrupt if sibling isn't of the same type.
+	rebalanceWith(sibling Node[V], downKey Bytes) (upKey Bytes, err error)
 	// len returns the number of keys or pointers in LeafNode or InternalNode respectively.
 	// It is used to choose which sibling to rebalance a node with
 	len() int
+	// size returns the number of keys in the subtree rooted at the node.
+	size() int
 	isLeaf() bool
+	// context returns the context of the tree that is allowed to modify the node in place
+	context() *treeContext
+	// clone returns a copy of the node that belongs to ctx
+	clone(ctx *treeContext) Node[V]
+	// digest returns the Merkle digest of the subtree rooted at the node, see BTree.RootHash
+	// encode returns the encoding of a value, which must be nil only for values that are nil
+	digest(encode func(v V) Bytes) Hash
+	// invalidateDigest must be called before the node is modified
+	invalidateDigest()
+}
+
+// treeContext is shared by all nodes that a tree is allowed to modify in place. Cloning a tree gives both
+// trees new contexts, so nodes that existed before are shared, and are copied before being modified.
+// A nil context uses the defaults.
+type treeContext struct {
+	cmp          Comparator // nil means bytes.Compare
+	copyKeys     bool       // leaves store copies of inserted keys, see Options.CopyKeys
+	compressKeys bool       // leaves store keys without their shared prefix, see Options.CompressKeys
+}
+
+// fork returns a new context with the same configuration
+func (c *treeContext) fork() *treeContext {
+	f := &treeContext{}
+	if c != nil {
+		*f = *c
+	}
+	return f
+}
+
+func (c *treeContext) comparator() Comparator {
+	if c == nil || c.cmp == nil {
+		return bytes.Compare
+	}
+	return c.cmp
+}
+
+func (c *treeContext) compare(a, b Bytes) int {
+	return c.comparator()(a, b)
+}
+
+func (c *treeContext) copiesKeys() bool {
+	return c != nil && (c.copyKeys || c.compressKeys)
+}
+
+func (c *treeContext) compressesKeys() bool {
+	return c != nil && c.compressKeys
 }
 
 type TraversalPositions[V any] struct {
@@ -38,34 +87,65 @@ func leafAndPathForKey[V any](n Node[V], key Bytes, st Stack[TraversalPositions[
 	return n.(*LeafNode[V]), st
 }
 
-func setOrInsert[V any](n Node[V], key Bytes, value *V, st Stack[TraversalPositions[V]]) (Bytes, Node[V]) {
+// mutableLeafAndPathForKey is leafAndPathForKey for modifications, nodes on the path that are shared with
+// other trees are replaced with copies. n must belong to the same context as the tree.
+func mutableLeafAndPathForKey[V any](n Node[V], key Bytes, st Stack[TraversalPositions[V]]) (*LeafNode[V], Stack[TraversalPositions[V]]) {
+	for !n.isLeaf() {
+		ni := n.(*InternalNode[V])
+		ci := ni.childIndexForKey(key)
+		n = ni.mutableChild(ci)
+		st.Push(TraversalPositions[V]{node: ni, pos: ci})
+	}
+	return n.(*LeafNode[V]), st
+}
+
+// setOrInsert sets the value of key in the subtree under n, inserted is false if only the value of an existing key was updated
+func setOrInsert[V any](n Node[V], key Bytes, value V, st Stack[TraversalPositions[V]]) (upKey Bytes, newNode Node[V], inserted bool, err error) {
 	defer st.Clear()
-	l, st := leafAndPathForKey(n, key, st)
-	key, newNode := l.setOrInsert(key, value)
-	for newNode != nil && !st.Empty() {
+	l, st := mutableLeafAndPathForKey(n, key, st)
+	return setOrInsertAtLeaf(l, key, value, st)
+}
+
+// setOrInsertAtLeaf sets the value of key in l and updates the nodes on the path to l, which must be mutable
+func setOrInsertAtLeaf[V any](l *LeafNode[V], key Bytes, value V, st Stack[TraversalPositions[V]]) (upKey Bytes, newNode Node[V], inserted bool, err error) {
+	upKey, newNode, inserted = l.setOrInsert(key, value)
+	for !st.Empty() {
 		p, _ := st.Pop()
-		key, newNode = p.node.handleInsert(p.pos, key, newNode)
+		upKey, newNode, err = p.node.handleInsert(p.pos, upKey, newNode, inserted)
+		if err != nil {
+			return nil, nil, false, err
+		}
 	}
 
-	return key, newNode
+	return upKey, newNode, inserted, nil
 }
 
-func deleteFromNode[V any](n Node[V], key Bytes, st Stack[TraversalPositions[V]]) bool {
+func deleteFromNode[V any](n Node[V], key Bytes, st Stack[TraversalPositions[V]]) (bool, error) {
 	defer st.Clear()
-	l, st := leafAndPathForKey(n, key, st)
+	l, st := mutableLeafAndPathForKey(n, key, st)
+	return deleteAtLeaf(l, key, st)
+}
+
+// deleteAtLeaf deletes key from l and updates the nodes on the path to l, which must be mutable
+func deleteAtLeaf[V any](l *LeafNode[V], key Bytes, st Stack[TraversalPositions[V]]) (bool, error) {
 	del := l.delete(key)
 	for !st.Empty() {
 		p, _ := st.Pop()
-		del = p.node.handleDelete(p.pos, del)
+		var err error
+		del, err = p.node.handleDelete(p.pos, del)
+		if err != nil {
+			return false, err
+		}
 	}
-	return del
+	return del, nil
 }
 
-func valueRef[V any](n Node[V], key Bytes) *V {
+// lookup returns the value of key in the subtree under n, and whether the key exists
+func lookup[V any](n Node[V], key Bytes) (V, bool) {
 	l, _ := leafAndPathForKey(n, key, nil)
-	i, _ := lowerBoundBytesArr(l.keys, key)
-	if i < l.len() && bytes.Equal(l.keys[i], key) {
-		return l.values[i]
+	if i, exists := l.search(key); exists {
+		return l.values[i], true
 	}
-	return nil
+	var zero V
+	return zero, false
 }
@@ -0,0 +1,122 @@
+package btree
+
+import (
+	"fmt"
+	"iter"
+)
+
+// OrderedMap is a tree with typed keys, which are stored using an order-preserving KeyCodec.
+// Unlike Map, iteration follows the order of the keys and yields them back as K.
+// The tree is only written through the typed methods, so all stored keys are encodings of K.
+type OrderedMap[K any, V any] struct {
+	tree  *BTree[V]
+	codec KeyCodec[K]
+	err   error // first error hit by an iterator
+}
+
+func NewOrderedMap[K any, V any](degree int, codec KeyCodec[K], expectedHeight int) *OrderedMap[K, V] {
+	return &OrderedMap[K, V]{
+		tree:  NewBTree[V](degree, expectedHeight),
+		codec: codec,
+	}
+}
+
+func (m *OrderedMap[K, V]) encode(key K) Bytes {
+	return m.codec.Append(nil, key)
+}
+
+func (m *OrderedMap[K, V]) Degree() int {
+	return m.tree.Degree()
+}
+
+// Len returns the number of keys in the map in O(1) time
+func (m *OrderedMap[K, V]) Len() int {
+	return m.tree.Len()
+}
+
+func (m *OrderedMap[K, V]) Set(key K, v *V) error {
+	return m.tree.SetOp(m.encode(key), v)
+}
+
+func (m *OrderedMap[K, V]) Get(key K) *V {
+	return m.tree.GetOp(m.encode(key))
+}
+
+func (m *OrderedMap[K, V]) Del(key K) (bool, error) {
+	return m.tree.DelOp(m.encode(key))
+}
+
+// typed decodes the keys yielded by seq. A key that can't be decoded, which only happens if the codec
+// doesn't decode its own encodings, stops the iteration and is reported by Err.
+func (m *OrderedMap[K, V]) typed(seq iter.Seq2[Bytes, *V]) iter.Seq2[K, *V] {
+	return func(yield func(K, *V) bool) {
+		for b, v := range seq {
+			k, _, err := m.codec.Decode(b)
+			if err != nil {
+				m.err = fmt.Errorf("btree: stored key %x can't be decoded: %w", b, err)
+				return
+			}
+			if !yield(k, v) {
+				return
+			}
+		}
+	}
+}
+
+// Err returns the first error that stopped an iteration
+func (m *OrderedMap[K, V]) Err() error {
+	return m.err
+}
+
+func (m *OrderedMap[K, V]) All() iter.Seq2[K, *V] {
+	return m.typed(m.tree.All())
+}
+
+// Range iterates over the pairs with keys in [low, high) in ascending order, see RangeBounds for other bounds
+func (m *OrderedMap[K, V]) Range(low, high K) iter.Seq2[K, *V] {
+	return m.typed(m.tree.Range(m.encode(low), m.encode(high)))
+}
+
+// Backward iterates over the pairs with keys in [low, high) in descending order
+func (m *OrderedMap[K, V]) Backward(low, high K) iter.Seq2[K, *V] {
+	return m.typed(m.tree.Backward(m.encode(low), m.encode(high)))
+}
+
+// KeyBounds is one end of a range of typed keys, see Bounds. The zero value is unbounded.
+type KeyBounds[K any] struct {
+	key  K
+	kind boundKind
+}
+
+// IncludedKey returns a bound that includes key
+func IncludedKey[K any](key K) KeyBounds[K] {
+	return KeyBounds[K]{key: key, kind: boundIncluded}
+}
+
+// ExcludedKey returns a bound that excludes key
+func ExcludedKey[K any](key K) KeyBounds[K] {
+	return KeyBounds[K]{key: key, kind: boundExcluded}
+}
+
+// UnboundedKey returns a bound that doesn't limit its side of the range
+func UnboundedKey[K any]() KeyBounds[K] {
+	return KeyBounds[K]{}
+}
+
+// bounds encodes the key of b
+func (m *OrderedMap[K, V]) bounds(b KeyBounds[K]) Bounds {
+	if b.kind == boundUnbounded {
+		return Unbounded()
+	}
+	return Bounds{key: m.encode(b.key), kind: b.kind}
+}
+
+// RangeBounds iterates over the pairs with keys between lo and hi in ascending order
+func (m *OrderedMap[K, V]) RangeBounds(lo, hi KeyBounds[K]) iter.Seq2[K, *V] {
+	return m.typed(m.tree.RangeBounds(m.bounds(lo), m.bounds(hi)))
+}
+
+// BackwardBounds iterates over the pairs with keys between lo and hi in descending order
+func (m *OrderedMap[K, V]) BackwardBounds(lo, hi KeyBounds[K]) iter.Seq2[K, *V] {
+	return m.typed(m.tree.BackwardBounds(m.bounds(lo), m.bounds(hi)))
+}
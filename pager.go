@@ -0,0 +1,63 @@
+package btree
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// pageID is the index of a page in the page file. Page 0 always holds the file metadata,
+// so 0 is also used as the null page reference.
+type pageID = uint64
+
+const nullPage pageID = 0
+
+// pager reads and writes fixed-size pages of a single file, it doesn't do any caching by itself.
+type pager struct {
+	file     *os.File
+	pageSize int
+}
+
+func openPager(path string, pageSize int) (*pager, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+	return &pager{file: f, pageSize: pageSize}, nil
+}
+
+// empty returns whether nothing was ever written to the file. The page size of an existing file is only
+// known once its meta page is read, so the size of the file in pages isn't used for this.
+func (p *pager) empty() (bool, error) {
+	st, err := p.file.Stat()
+	if err != nil {
+		return false, err
+	}
+	return st.Size() == 0, nil
+}
+
+func (p *pager) readPage(id pageID, buf []byte) error {
+	n, err := p.file.ReadAt(buf[:p.pageSize], int64(id)*int64(p.pageSize))
+	if err == io.EOF && n == p.pageSize {
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("btree: reading page %d: %w", id, err)
+	}
+	return nil
+}
+
+func (p *pager) writePage(id pageID, buf []byte) error {
+	if _, err := p.file.WriteAt(buf[:p.pageSize], int64(id)*int64(p.pageSize)); err != nil {
+		return fmt.Errorf("btree: writing page %d: %w", id, err)
+	}
+	return nil
+}
+
+func (p *pager) sync() error {
+	return p.file.Sync()
+}
+
+func (p *pager) close() error {
+	return p.file.Close()
+}
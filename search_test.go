@@ -0,0 +1,76 @@
+package btree
+
+import (
+	"bytes"
+	"fmt"
+	"math/rand"
+	"slices"
+	"testing"
+)
+
+// Both search strategies must return the same lower bound, for present and absent keys
+func TestSearchStrategiesAgree(t *testing.T) {
+	for _, n := range []int{0, 1, 2, 7, 8, 9, 33, 100, 255} {
+		arr := sortedTestKeys(n)
+		queries := append(slices.Clone(arr), nil, Bytes{}, Bytes{0xff}, Bytes("00000000\x00"))
+		for range 50 {
+			q := RandASCIIByte32(0)
+			queries = append(queries, q[:])
+		}
+		for _, q := range queries {
+			li, lok := linearLowerBound(arr, q, bytes.Compare)
+			bi, bok := binaryLowerBound(arr, q, bytes.Compare)
+			if li != bi || lok != bok {
+				t.Fatalf("n=%d key %q: linear %d %v, binary %d %v", n, q, li, lok, bi, bok)
+			}
+		}
+	}
+}
+
+var benchDegrees = []int{4, 8, 16, 32, 64, 128, 256}
+
+// BenchmarkLowerBound compares the search strategies on nodes of different sizes
+func BenchmarkLowerBound(b *testing.B) {
+	strategies := []struct {
+		name   string
+		search func([]Bytes, Bytes, Comparator) (int, bool)
+	}{
+		{"linear", linearLowerBound},
+		{"binary", binaryLowerBound},
+		{"adaptive", lowerBoundFunc},
+	}
+	for _, n := range benchDegrees {
+		// every other key is in the node, so that half of the queries miss
+		queries := sortedTestKeys(2 * n)
+		arr := make([]Bytes, 0, n)
+		for i := 0; i < len(queries); i += 2 {
+			arr = append(arr, queries[i])
+		}
+		for _, s := range strategies {
+			b.Run(fmt.Sprintf("%s/keys=%d", s.name, n), func(b *testing.B) {
+				for i := range b.N {
+					s.search(arr, queries[i%len(queries)], bytes.Compare)
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkTreeGet measures lookups in trees of different degrees, which use the search strategy
+// chosen by the size of each node
+func BenchmarkTreeGet(b *testing.B) {
+	const nKeys = 100_000
+	keys, values := GetData(nKeys)
+	for _, degree := range benchDegrees {
+		tree := NewBTree[int](degree, 8)
+		for i := range keys {
+			tree.SetOp(keys[i][:], &values[i])
+		}
+		perm := rand.Perm(nKeys)
+		b.Run(fmt.Sprintf("degree=%d", degree), func(b *testing.B) {
+			for i := range b.N {
+				tree.GetOp(keys[perm[i%nKeys]][:])
+			}
+		})
+	}
+}
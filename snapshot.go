@@ -0,0 +1,102 @@
+package btree
+
+import "iter"
+
+// Snapshot is a read-only view of a BTree at the time it was taken. Later changes to the tree are never
+// visible in the snapshot, and reading from it is safe while the tree is being modified.
+type Snapshot[V any] struct {
+	tree *BTree[V]
+}
+
+// Snapshot returns a read-only view of the tree in O(1) time, see Clone
+func (b *BTree[V]) Snapshot() *Snapshot[V] {
+	return &Snapshot[V]{tree: b.Clone()}
+}
+
+func (s *Snapshot[V]) Degree() int {
+	return s.tree.Degree()
+}
+
+func (s *Snapshot[V]) Len() int {
+	return s.tree.Len()
+}
+
+func (s *Snapshot[V]) GetOp(key Bytes) *V {
+	return s.tree.GetOp(key)
+}
+
+func (s *Snapshot[V]) Rank(key Bytes) int {
+	return s.tree.Rank(key)
+}
+
+func (s *Snapshot[V]) Select(i int) (Bytes, *V) {
+	return s.tree.Select(i)
+}
+
+func (s *Snapshot[V]) Min() (Bytes, *V, bool) {
+	return s.tree.Min()
+}
+
+func (s *Snapshot[V]) Max() (Bytes, *V, bool) {
+	return s.tree.Max()
+}
+
+func (s *Snapshot[V]) Floor(key Bytes) (Bytes, *V, bool) {
+	return s.tree.Floor(key)
+}
+
+func (s *Snapshot[V]) Ceiling(key Bytes) (Bytes, *V, bool) {
+	return s.tree.Ceiling(key)
+}
+
+func (s *Snapshot[V]) Lower(key Bytes) (Bytes, *V, bool) {
+	return s.tree.Lower(key)
+}
+
+func (s *Snapshot[V]) Higher(key Bytes) (Bytes, *V, bool) {
+	return s.tree.Higher(key)
+}
+
+func (s *Snapshot[V]) Cursor() *Cursor[V] {
+	return s.tree.Cursor()
+}
+
+func (s *Snapshot[V]) All() iter.Seq2[Bytes, *V] {
+	return s.tree.All()
+}
+
+func (s *Snapshot[V]) Range(low, high Bytes) iter.Seq2[Bytes, *V] {
+	return s.tree.Range(low, high)
+}
+
+func (s *Snapshot[V]) Prefix(p Bytes) iter.Seq2[Bytes, *V] {
+	return s.tree.Prefix(p)
+}
+
+func (s *Snapshot[V]) Backward(low, high Bytes) iter.Seq2[Bytes, *V] {
+	return s.tree.Backward(low, high)
+}
+
+func (s *Snapshot[V]) RangeBounds(lo, hi Bounds) iter.Seq2[Bytes, *V] {
+	return s.tree.RangeBounds(lo, hi)
+}
+
+func (s *Snapshot[V]) BackwardBounds(lo, hi Bounds) iter.Seq2[Bytes, *V] {
+	return s.tree.BackwardBounds(lo, hi)
+}
+
+func (s *Snapshot[V]) RootHash() Hash {
+	return s.tree.RootHash()
+}
+
+func (s *Snapshot[V]) Prove(key Bytes) *Proof {
+	return s.tree.Prove(key)
+}
+
+func (s *Snapshot[V]) Validate() error {
+	return s.tree.Validate()
+}
+
+func (s *Snapshot[V]) Stats() Stats {
+	return s.tree.Stats()
+}
@@ -0,0 +1,126 @@
+package btree
+
+import (
+	"bytes"
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+func checkTreeContents(t *testing.T, b *BTree[int], want map[Hash]int) {
+	t.Helper()
+	if un, to := b.root.numUnhealthyChildren(); un != 0 {
+		t.Fatalf("unhealthy children ratio = %d/%d", un, to)
+	}
+	if err := b.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	var prev Bytes
+	for k, v := range b.All() {
+		if wv, ok := want[Hash(k)]; !ok || *v != wv {
+			t.Fatalf("unexpected pair for key %s", k)
+		}
+		if prev != nil && bytes.Compare(prev, k) >= 0 {
+			t.Fatalf("keys out of order")
+		}
+		prev = k
+		n++
+	}
+	if n != len(want) || b.Len() != n {
+		t.Fatalf("expected %d keys, got %d with Len %d", len(want), n, b.Len())
+	}
+}
+
+// Changes to a tree and to its clone must not be visible in the other
+func TestTreeCloneIndependence(t *testing.T) {
+	const nKeys = 3000
+	a := NewBTree[int](4, 4)
+	keys, values := GetData(2 * nKeys)
+	wantA := map[Hash]int{}
+	for i := range keys[:nKeys] {
+		a.SetOp(keys[i][:], &values[i])
+		wantA[keys[i]] = values[i]
+	}
+
+	b := a.Clone()
+	if a.root != b.root {
+		t.Fatalf("clone copied the root")
+	}
+	wantB := map[Hash]int{}
+	for k, v := range wantA {
+		wantB[k] = v
+	}
+
+	// a deletes most keys, b updates old keys and inserts new ones
+	perm := rand.Perm(nKeys)
+	for _, i := range perm[:nKeys*3/4] {
+		a.DelOp(keys[i][:])
+		delete(wantA, keys[i])
+	}
+	for i := range keys {
+		v := -values[i]
+		b.SetOp(keys[i][:], &v)
+		wantB[keys[i]] = v
+	}
+
+	checkTreeContents(t, a, wantA)
+	checkTreeContents(t, b, wantB)
+
+	// clones of clones
+	c := b.Clone()
+	for _, i := range perm {
+		c.DelOp(keys[i][:])
+	}
+	for k := range c.All() {
+		if bytes.Equal(k, keys[perm[0]][:]) {
+			t.Fatalf("deleted key still in clone")
+		}
+	}
+	checkTreeContents(t, b, wantB)
+	checkTreeContents(t, a, wantA)
+}
+
+// A snapshot must keep returning the same data while the tree is modified, run with -race
+func TestTreeSnapshotStable(t *testing.T) {
+	c := NewConcurrentBTree[int](5, 4)
+	keys, values := GetData(4000)
+	want := map[Hash]int{}
+	for i := range keys[:2000] {
+		c.SetOp(keys[i][:], &values[i])
+		want[keys[i]] = values[i]
+	}
+	snap := c.Snapshot()
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := range keys[2000:] {
+			c.SetOp(keys[2000+i][:], &values[2000+i])
+			c.DelOp(keys[i][:])
+		}
+	}()
+
+	for range 5 {
+		n := 0
+		for k, v := range snap.All() {
+			if *v != want[Hash(k)] {
+				t.Errorf("snapshot value changed")
+				break
+			}
+			n++
+		}
+		if n != len(want) {
+			t.Errorf("snapshot has %d keys, expected %d", n, len(want))
+		}
+		for i := range keys[:2000] {
+			if v := snap.GetOp(keys[i][:]); v == nil || *v != values[i] {
+				t.Errorf("snapshot lost key %d", i)
+				break
+			}
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,93 @@
+package btree
+
+import (
+	"unsafe"
+)
+
+// Stats describes the shape and memory use of a tree
+type Stats struct {
+	Keys          int
+	Height        int
+	InternalNodes int
+	LeafNodes     int
+	Levels        []LevelStats // levels from the root down to the leaves
+	KeyBytes      int          // total length of the keys
+	// HeapBytes estimates the memory used by nodes and keys, including unused capacity, and the values
+	// pointed to but not memory referenced by them. Nodes shared with clones are counted in full.
+	HeapBytes int
+}
+
+// LevelStats describes the nodes at one level of a tree. Fill is the fraction of the capacity of a node
+// in use, in keys for leaves and in pointers for internal nodes.
+type LevelStats struct {
+	Nodes   int
+	AvgFill float64
+	MinFill float64
+}
+
+// Stats walks the tree and returns its statistics in O(n) time
+func (b *BTree[V]) Stats() Stats {
+	s := Stats{Keys: b.Len(), Height: b.height}
+	level := []Node[*V]{b.root}
+	for len(level) > 0 {
+		ls := LevelStats{Nodes: len(level), MinFill: 1}
+		var next []Node[*V]
+		for _, n := range level {
+			var fill float64
+			switch n := n.(type) {
+			case *InternalNode[*V]:
+				s.InternalNodes++
+				s.HeapBytes += internalNodeHeapBytes(n)
+				fill = float64(n.len()) / float64(cap(n.pointers))
+				next = append(next, n.pointers...)
+			case *LeafNode[*V]:
+				s.LeafNodes++
+				s.HeapBytes += leafNodeHeapBytes(n)
+				fill = float64(n.len()) / float64(cap(n.keys))
+				s.KeyBytes += n.len() * len(n.prefix)
+				for _, k := range n.keys {
+					s.KeyBytes += len(k)
+				}
+			}
+			ls.AvgFill += fill
+			ls.MinFill = min(ls.MinFill, fill)
+		}
+		ls.AvgFill /= float64(len(level))
+		s.Levels = append(s.Levels, ls)
+		level = next
+	}
+	return s
+}
+
+// internalNodeHeapBytes counts the separators only if the tree copies keys, otherwise they share memory
+// with keys in the leaves
+func internalNodeHeapBytes[V any](n *InternalNode[*V]) int {
+	total := int(unsafe.Sizeof(*n)) +
+		cap(n.keys)*int(unsafe.Sizeof(Bytes(nil))) +
+		cap(n.pointers)*int(unsafe.Sizeof(Node[*V](nil))) +
+		cap(n.counts)*int(unsafe.Sizeof(int64(0)))
+	if n.ctx.copiesKeys() {
+		total += cap(n.prefix)
+		for _, k := range n.keys {
+			total += cap(k)
+		}
+	}
+	return total
+}
+
+func leafNodeHeapBytes[V any](l *LeafNode[*V]) int {
+	var v V
+	total := int(unsafe.Sizeof(*l)) +
+		cap(l.keys)*int(unsafe.Sizeof(Bytes(nil))) +
+		cap(l.values)*int(unsafe.Sizeof((*V)(nil))) +
+		cap(l.slab)
+	for i, k := range l.keys {
+		if l.slab == nil {
+			total += cap(k)
+		}
+		if l.values[i] != nil {
+			total += int(unsafe.Sizeof(v))
+		}
+	}
+	return total
+}
@@ -0,0 +1,89 @@
+package btree
+
+import (
+	"testing"
+)
+
+func TestStatsFullTree(t *testing.T) {
+	// 16 full leaves of 3 keys under 4 full internal nodes and the root
+	b, err := BuildFromSorted(4, sortedPairs(sortedTestKeys(48)), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := b.Stats()
+	if s.Keys != 48 || s.Height != 2 || s.InternalNodes != 5 || s.LeafNodes != 16 || s.KeyBytes != 48*8 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+	wantNodes := []int{1, 4, 16}
+	if len(s.Levels) != len(wantNodes) {
+		t.Fatalf("got %d levels", len(s.Levels))
+	}
+	for i, ls := range s.Levels {
+		if ls.Nodes != wantNodes[i] || ls.AvgFill != 1 || ls.MinFill != 1 {
+			t.Errorf("level %d: got %+v", i, ls)
+		}
+	}
+	if s.HeapBytes < s.KeyBytes {
+		t.Errorf("heap estimate %d smaller than the keys", s.HeapBytes)
+	}
+}
+
+func TestStatsAfterDeletes(t *testing.T) {
+	m, _, keys := buildComparableMaps(5000, 8)
+	before := m.Stats()
+	for _, k := range keys[:4000] {
+		m.Del(k)
+	}
+	after := m.Stats()
+
+	if after.Keys != 1000 || after.KeyBytes != 1000*32 {
+		t.Fatalf("got %d keys with %d bytes", after.Keys, after.KeyBytes)
+	}
+	if after.HeapBytes >= before.HeapBytes {
+		t.Errorf("heap estimate didn't shrink: %d >= %d", after.HeapBytes, before.HeapBytes)
+	}
+	leaves := after.Levels[len(after.Levels)-1]
+	if leaves.Nodes != after.LeafNodes || leaves.MinFill < 0.5 || leaves.MinFill > leaves.AvgFill {
+		t.Errorf("unexpected leaf level %+v", leaves)
+	}
+}
+
+func TestStatsEmptyTree(t *testing.T) {
+	s := NewBTree[int](4, 4).Stats()
+	if s.Keys != 0 || s.LeafNodes != 1 || s.InternalNodes != 0 || len(s.Levels) != 1 || s.Levels[0].MinFill != 0 {
+		t.Fatalf("unexpected stats %+v", s)
+	}
+}
+
+// Separators are copies when the tree copies keys, so they count in the heap estimate
+func TestStatsCountsCopiedSeparators(t *testing.T) {
+	b, err := New(Options[int]{Degree: 4, CopyKeys: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain := NewBTree[int](4, 4)
+	for i, k := range tenantKeys(500) {
+		b.SetOp(k, &i)
+		plain.SetOp(k, &i)
+	}
+
+	// both trees have the same shape, only the separators of b are copies
+	internalBytes := func(b *BTree[int]) (heap, seps int) {
+		for _, level := range treeLevels(b.root) {
+			for _, n := range level {
+				if in, ok := n.(*InternalNode[*int]); ok {
+					heap += internalNodeHeapBytes(in)
+					for _, k := range in.keys {
+						seps += cap(k)
+					}
+				}
+			}
+		}
+		return heap, seps
+	}
+	heap, seps := internalBytes(b)
+	plainHeap, _ := internalBytes(plain)
+	if seps == 0 || heap-plainHeap != seps {
+		t.Fatalf("internal nodes use %d bytes with %d bytes of copied separators, %d without", heap, seps, plainHeap)
+	}
+}
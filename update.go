@@ -0,0 +1,83 @@
+package btree
+
+// Action tells Update what to do with the key after the update function returns
+type Action int
+
+const (
+	ActionKeep   Action = iota // leave the tree unchanged
+	ActionSet                  // set the key to the returned value, inserting it if needed
+	ActionDelete               // delete the key if it exists
+)
+
+// Update calls fn with the value of key and whether it exists, and then sets or deletes the key as told by
+// the returned action. The key is found with a single descent, and nodes are only copied or modified if
+// the action changes the tree.
+func (b *BTree[V]) Update(key Bytes, fn func(old *V, exists bool) (new *V, action Action)) error {
+	_, _, err := b.update(key, fn)
+	return err
+}
+
+// update is Update that also returns the value of key before the update and whether it existed
+func (b *BTree[V]) update(key Bytes, fn func(old *V, exists bool) (*V, Action)) (old *V, exists bool, err error) {
+	l, st := leafAndPathForKey(b.root, key, b.stack)
+	defer st.Clear()
+	idx, exists := l.search(key)
+	if exists {
+		old = l.values[idx]
+	}
+
+	value, action := fn(old, exists)
+	switch {
+	case action == ActionSet:
+		err = b.finishInsert(setOrInsertAtLeaf(b.mutablePath(st), key, value, st))
+	case action == ActionDelete && exists:
+		_, err = b.finishDelete(deleteAtLeaf(b.mutablePath(st), key, st))
+	}
+	return old, exists, err
+}
+
+// mutablePath replaces the nodes on a path found by leafAndPathForKey that are shared with other trees
+// with copies, see mutableLeafAndPathForKey. It returns the leaf at the end of the path.
+func (b *BTree[V]) mutablePath(st Stack[TraversalPositions[*V]]) *LeafNode[*V] {
+	n := b.mutableRoot()
+	for i := range st {
+		ni := n.(*InternalNode[*V])
+		st[i].node = ni
+		n = ni.mutableChild(st[i].pos)
+	}
+	return n.(*LeafNode[*V])
+}
+
+// GetOrInsert returns the value of key if it exists, otherwise it inserts value and returns it.
+// loaded is true if the key existed.
+func (b *BTree[V]) GetOrInsert(key Bytes, value *V) (actual *V, loaded bool, err error) {
+	old, exists, err := b.update(key, func(old *V, exists bool) (*V, Action) {
+		if exists {
+			return nil, ActionKeep
+		}
+		return value, ActionSet
+	})
+	if exists {
+		return old, true, err
+	}
+	return value, false, err
+}
+
+// CompareAndSwap sets key to new if its current value is the pointer old, and returns whether it did.
+// Values are compared by pointer, so old is usually a value returned by GetOp.
+func (b *BTree[V]) CompareAndSwap(key Bytes, old, new *V) (swapped bool, err error) {
+	err = b.Update(key, func(cur *V, exists bool) (*V, Action) {
+		if !exists || cur != old {
+			return nil, ActionKeep
+		}
+		swapped = true
+		return new, ActionSet
+	})
+	return swapped && err == nil, err
+}
+
+// InsertIfAbsent inserts the pair if key doesn't exist, and returns whether it did
+func (b *BTree[V]) InsertIfAbsent(key Bytes, value *V) (inserted bool, err error) {
+	_, loaded, err := b.GetOrInsert(key, value)
+	return !loaded && err == nil, err
+}
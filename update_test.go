@@ -0,0 +1,122 @@
+package btree
+
+import (
+	"math/rand"
+	"sync"
+	"testing"
+)
+
+// Random updates must leave the tree in the same state as the equivalent GetOp, SetOp and DelOp calls
+func TestUpdateActions(t *testing.T) {
+	b := NewBTree[int](4, 4)
+	want := map[Hash]int{}
+	keys, _ := GetData(500)
+	for range 20000 {
+		k := keys[rand.Intn(len(keys))]
+		wv, wexists := want[k]
+		action := Action(rand.Intn(3))
+		err := b.Update(k[:], func(old *int, exists bool) (*int, Action) {
+			if exists != wexists || (exists && *old != wv) {
+				t.Fatalf("update got %v %v, want %d %v", old, exists, wv, wexists)
+			}
+			n := wv + 1
+			return &n, action
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		switch action {
+		case ActionSet:
+			want[k] = wv + 1
+		case ActionDelete:
+			delete(want, k)
+		}
+	}
+	checkTreeContents(t, b, want)
+}
+
+func TestUpdateOnClone(t *testing.T) {
+	b := NewBTree[int](4, 4)
+	keys, values := GetData(1000)
+	want := map[Hash]int{}
+	for i := range keys {
+		b.SetOp(keys[i][:], &values[i])
+		want[keys[i]] = values[i]
+	}
+	c := b.Clone()
+	root := c.root
+
+	// keeping the value must not copy any node
+	for i := range keys {
+		c.Update(keys[i][:], func(*int, bool) (*int, Action) { return nil, ActionKeep })
+	}
+	if c.root != root {
+		t.Fatalf("ActionKeep copied the root")
+	}
+
+	for i := range keys[:500] {
+		c.Update(keys[i][:], func(*int, bool) (*int, Action) { return nil, ActionDelete })
+	}
+	checkTreeContents(t, b, want)
+	if c.Len() != 500 {
+		t.Fatalf("clone has %d keys", c.Len())
+	}
+}
+
+func TestGetOrInsertAndCompareAndSwap(t *testing.T) {
+	b := NewBTree[int](3, 4)
+	one, two, three := 1, 2, 3
+	key := Bytes("k")
+
+	if v, loaded, _ := b.GetOrInsert(key, &one); loaded || v != &one {
+		t.Fatalf("GetOrInsert on absent key: %v %v", v, loaded)
+	}
+	if v, loaded, _ := b.GetOrInsert(key, &two); !loaded || v != &one {
+		t.Fatalf("GetOrInsert on present key: %v %v", v, loaded)
+	}
+	if ok, _ := b.InsertIfAbsent(key, &two); ok {
+		t.Fatalf("InsertIfAbsent replaced a value")
+	}
+	if ok, _ := b.InsertIfAbsent(Bytes("other"), &two); !ok || b.Len() != 2 {
+		t.Fatalf("InsertIfAbsent didn't insert")
+	}
+
+	if ok, _ := b.CompareAndSwap(key, &two, &three); ok {
+		t.Fatalf("swapped with the wrong old value")
+	}
+	if ok, _ := b.CompareAndSwap(key, &one, &three); !ok || b.GetOp(key) != &three {
+		t.Fatalf("swap failed")
+	}
+	if ok, _ := b.CompareAndSwap(Bytes("missing"), nil, &three); ok || b.Len() != 2 {
+		t.Fatalf("swapped a missing key")
+	}
+}
+
+// Concurrent increments with CompareAndSwap retries must not lose updates, run with -race
+func TestConcurrentCompareAndSwapCounter(t *testing.T) {
+	c := NewConcurrentBTree[int](4, 4)
+	key := Bytes("counter")
+	zero := 0
+	c.InsertIfAbsent(key, &zero)
+
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 200 {
+				for {
+					old := c.GetOp(key)
+					n := *old + 1
+					if ok, _ := c.CompareAndSwap(key, old, &n); ok {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if v := c.GetOp(key); *v != 1600 {
+		t.Fatalf("counter is %d", *v)
+	}
+}
@@ -44,11 +44,11 @@ func computeMapHeight[K, V any](m *Map[K, V]) int {
 	height := 0
 	for {
 		switch node.(type) {
-		case *LeafNode[V]:
+		case *LeafNode[*V]:
 			return height
-		case *InternalNode[V]:
+		case *InternalNode[*V]:
 			height++
-			node = node.(*InternalNode[V]).pointers[0]
+			node = node.(*InternalNode[*V]).pointers[0]
 		}
 	}
 }
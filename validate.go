@@ -0,0 +1,159 @@
+package btree
+
+import (
+	"fmt"
+)
+
+// ValidationError describes the first node found by Validate to break an invariant of the tree.
+// It wraps ErrCorrupt.
+type ValidationError struct {
+	Path   []int // indices of the pointers followed from the root to the node, empty for the root
+	Leaf   bool
+	Reason string
+}
+
+func (e *ValidationError) Error() string {
+	kind := "internal node"
+	if e.Leaf {
+		kind = "leaf"
+	}
+	return fmt.Sprintf("btree: invalid %s at path %v: %s", kind, e.Path, e.Reason)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return ErrCorrupt
+}
+
+// Validate checks all invariants of the tree and returns a *ValidationError for the first node that breaks
+// one, visiting nodes in key order. It checks that
+//   - keys of each node are sorted and unique
+//   - separators bound the keys of their children
+//   - all leaves are at the recorded height
+//   - nodes other than the root are at least half full, and an internal root has at least 2 children
+//   - subtree counts are correct
+//   - links between leaves of the same tree follow key order
+//
+// It takes O(n) time.
+func (b *BTree[V]) Validate() error {
+	return b.validate()
+}
+
+type validator[V any] struct {
+	ctx    *treeContext
+	cmp    Comparator
+	height int
+	prev   *LeafNode[V] // last leaf visited
+	path   []int
+}
+
+func (v *validator[V]) fail(leaf bool, f string, a ...any) error {
+	return &ValidationError{Path: append([]int{}, v.path...), Leaf: leaf, Reason: fmt.Sprintf(f, a...)}
+}
+
+// keys checks that keys are sorted, unique and in [low, high), where nil bounds are unbounded
+func (v *validator[V]) keys(leaf bool, keys []Bytes, low, high Bytes) error {
+	for i, k := range keys {
+		if i > 0 && v.cmp(keys[i-1], k) >= 0 {
+			return v.fail(leaf, "key %d %q is not larger than key %d %q", i, k, i-1, keys[i-1])
+		}
+	}
+	if len(keys) == 0 {
+		return nil
+	}
+	if low != nil && v.cmp(keys[0], low) < 0 {
+		return v.fail(leaf, "key %q is smaller than the separator %q", keys[0], low)
+	}
+	if last := keys[len(keys)-1]; high != nil && v.cmp(last, high) >= 0 {
+		return v.fail(leaf, "key %q is not smaller than the separator %q", last, high)
+	}
+	return nil
+}
+
+func (v *validator[V]) node(n Node[V], parent *InternalNode[V], low, high Bytes) error {
+	switch n := n.(type) {
+	case *LeafNode[V]:
+		return v.leaf(n, parent, low, high)
+	case *InternalNode[V]:
+		return v.internal(n, parent, low, high)
+	}
+	return v.fail(false, "unknown node type %T", n)
+}
+
+func (v *validator[V]) internal(n *InternalNode[V], parent *InternalNode[V], low, high Bytes) error {
+	if len(v.path) >= v.height {
+		return v.fail(false, "internal node at depth %d of a tree of height %d", len(v.path), v.height)
+	}
+	if len(n.keys) != n.len()-1 {
+		return v.fail(false, "%d keys for %d pointers", len(n.keys), n.len())
+	}
+	if len(n.counts) != n.len() {
+		return v.fail(false, "%d counts for %d pointers", len(n.counts), n.len())
+	}
+	if parent == nil && n.len() < 2 {
+		return v.fail(false, "root has %d pointers", n.len())
+	}
+	if parent != nil && n.needsRebalance() {
+		return v.fail(false, "%d pointers, the minimum is %d", n.len(), n.minCount)
+	}
+	keys := n.fullKeys()
+	if err := v.keys(false, keys, low, high); err != nil {
+		return err
+	}
+
+	for i, c := range n.pointers {
+		if c == nil {
+			return v.fail(false, "pointer %d is nil", i)
+		}
+		if n.counts[i] != int64(c.size()) {
+			return v.fail(false, "count %d is %d, the subtree has %d keys", i, n.counts[i], c.size())
+		}
+
+		lo, hi := low, high
+		if i > 0 {
+			lo = keys[i-1]
+		}
+		if i < len(keys) {
+			hi = keys[i]
+		}
+		v.path = append(v.path, i)
+		if err := v.node(c, n, lo, hi); err != nil {
+			return err
+		}
+		v.path = v.path[:len(v.path)-1]
+	}
+	return nil
+}
+
+func (v *validator[V]) leaf(l *LeafNode[V], parent *InternalNode[V], low, high Bytes) error {
+	if len(v.path) != v.height {
+		return v.fail(true, "leaf at depth %d of a tree of height %d", len(v.path), v.height)
+	}
+	if len(l.values) != l.len() {
+		return v.fail(true, "%d keys and %d values", l.len(), len(l.values))
+	}
+	if parent != nil && l.needsRebalance() {
+		return v.fail(true, "%d keys, the minimum is %d", l.len(), l.minCount)
+	}
+	if err := v.keys(true, l.fullKeys(), low, high); err != nil {
+		return err
+	}
+
+	// only links between leaves of the tree are maintained, shared leaves keep the links of the tree they
+	// were cloned from, see LeafNode.clone
+	prev := v.prev
+	if l.ctx == v.ctx && l.prev != nil && l.prev.ctx == v.ctx && l.prev != prev {
+		return v.fail(true, "prev link doesn't point to the previous leaf")
+	}
+	if prev != nil && prev.ctx == v.ctx && prev.next != nil && prev.next.ctx == v.ctx && prev.next != l {
+		return v.fail(true, "next link of the previous leaf doesn't point to the leaf")
+	}
+	if prev != nil && prev.len() > 0 && l.len() > 0 && v.cmp(prev.key(prev.len()-1), l.key(0)) >= 0 {
+		return v.fail(true, "first key %q is not larger than the last key of the previous leaf", l.key(0))
+	}
+	if next := l.next; l.ctx == v.ctx && next != nil && next.ctx == v.ctx && next.len() > 0 && l.len() > 0 &&
+		v.cmp(next.key(0), l.key(l.len()-1)) <= 0 {
+		return v.fail(true, "next link points to a leaf with smaller keys")
+	}
+	v.prev = l
+	return nil
+}
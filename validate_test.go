@@ -0,0 +1,102 @@
+package btree
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// buildValidationTree returns a tree of height 2 with 4 internal nodes of 4 leaves each
+func buildValidationTree(t *testing.T) *BTree[int] {
+	t.Helper()
+	b, err := BuildFromSorted(4, sortedPairs(sortedTestKeys(48)), 1)
+	if err != nil || b.height != 2 {
+		t.Fatalf("bad test tree: %v", err)
+	}
+	if err := b.Validate(); err != nil {
+		t.Fatalf("valid tree rejected: %v", err)
+	}
+	return b
+}
+
+func TestValidateReportsPath(t *testing.T) {
+	cases := []struct {
+		name    string
+		corrupt func(b *BTree[int]) []int
+		leaf    bool
+	}{
+		{"unsorted leaf", func(b *BTree[int]) []int {
+			l := b.root.(*InternalNode[*int]).pointers[1].(*InternalNode[*int]).pointers[0].(*LeafNode[*int])
+			l.keys[0], l.keys[1] = l.keys[1], l.keys[0]
+			return []int{1, 0}
+		}, true},
+		{"unsorted separators", func(b *BTree[int]) []int {
+			n := b.root.(*InternalNode[*int]).pointers[2].(*InternalNode[*int])
+			n.keys[0], n.keys[1] = n.keys[1], n.keys[0]
+			return []int{2}
+		}, false},
+		{"separator not bounding child", func(b *BTree[int]) []int {
+			b.root.(*InternalNode[*int]).keys[0] = Bytes("00000001")
+			return []int{0}
+		}, false},
+		{"wrong count", func(b *BTree[int]) []int {
+			b.root.(*InternalNode[*int]).counts[1]++
+			return []int{}
+		}, false},
+		{"underfull leaf", func(b *BTree[int]) []int {
+			l := b.root.(*InternalNode[*int]).pointers[0].(*InternalNode[*int]).pointers[1].(*LeafNode[*int])
+			l.keys, l.values = l.keys[:1], l.values[:1]
+			b.root.(*InternalNode[*int]).counts[0] -= 2
+			b.root.(*InternalNode[*int]).pointers[0].(*InternalNode[*int]).counts[1] = 1
+			return []int{0, 1}
+		}, true},
+		{"wrong height", func(b *BTree[int]) []int {
+			b.height++
+			return []int{0, 0}
+		}, true},
+		{"broken next link", func(b *BTree[int]) []int {
+			first, _ := leafAndPathForKey(b.root, nil, nil)
+			first.next = first.next.next
+			return []int{0, 1}
+		}, true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			b := buildValidationTree(t)
+			path := c.corrupt(b)
+			err := b.Validate()
+			var verr *ValidationError
+			if !errors.As(err, &verr) {
+				t.Fatalf("expected a validation error, got %v", err)
+			}
+			if !errors.Is(err, ErrCorrupt) {
+				t.Errorf("validation error doesn't wrap ErrCorrupt")
+			}
+			if !slices.Equal(verr.Path, path) || verr.Leaf != c.leaf {
+				t.Errorf("got %v, want path %v", err, path)
+			}
+		})
+	}
+}
+
+func TestValidateEmptyAndCloned(t *testing.T) {
+	b := NewBTree[int](3, 4)
+	if err := b.Validate(); err != nil {
+		t.Fatalf("empty tree rejected: %v", err)
+	}
+
+	b = buildValidationTree(t)
+	c := b.Clone()
+	keys, values := GetData(500)
+	for i := range keys {
+		b.SetOp(keys[i][:], &values[i])
+		c.SetOp(keys[i][:], nil)
+	}
+	if err := b.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,81 @@
+package btree
+
+import (
+	"fmt"
+	"iter"
+)
+
+// ValueBTree is a B+ tree that stores values inline in its leaves instead of pointers to them. For small
+// values that saves an allocation and a pointer dereference per pair, and unlike the nil returned by
+// BTree.GetOp, a missing key can be told apart from a stored zero value. Values are copied in and out.
+type ValueBTree[V any] struct {
+	treeCore[V]
+}
+
+// NewValueBTree returns an empty tree, or ErrInvalidDegree if the degree is less than 3
+func NewValueBTree[V any](degree int, expectedHeight int) (*ValueBTree[V], error) {
+	if degree < 3 {
+		return nil, fmt.Errorf("%w, got %d", ErrInvalidDegree, degree)
+	}
+	return &ValueBTree[V]{newTreeCore[V](degree, max(expectedHeight, 0), nil)}, nil
+}
+
+func (b *ValueBTree[V]) Degree() int {
+	return b.deg
+}
+
+// Len returns the number of keys in the tree in O(1) time
+func (b *ValueBTree[V]) Len() int {
+	return b.count
+}
+
+// Get returns the value of key and whether the key exists
+func (b *ValueBTree[V]) Get(key Bytes) (V, bool) {
+	return lookup(b.root, key)
+}
+
+// Set sets the value of key, inserting the key if it doesn't exist.
+// It returns ErrCorrupt if the tree breaks its invariants.
+func (b *ValueBTree[V]) Set(key Bytes, value V) error {
+	return b.finishInsert(setOrInsert(b.mutableRoot(), key, value, b.stack))
+}
+
+// Del deletes key from the tree and returns whether it was there.
+// It returns ErrCorrupt if the tree breaks its invariants.
+func (b *ValueBTree[V]) Del(key Bytes) (bool, error) {
+	return b.finishDelete(deleteFromNode(b.mutableRoot(), key, b.stack))
+}
+
+// Clone returns a copy of the tree in O(1) time, see BTree.Clone
+func (b *ValueBTree[V]) Clone() *ValueBTree[V] {
+	return &ValueBTree[V]{b.clone()}
+}
+
+// Validate checks the invariants of the tree, see BTree.Validate
+func (b *ValueBTree[V]) Validate() error {
+	return b.validate()
+}
+
+func (b *ValueBTree[V]) All() iter.Seq2[Bytes, V] {
+	return b.Range(nil, nil)
+}
+
+// Range iterates over the pairs with keys in [low, high) in ascending order, nil bounds are unbounded
+func (b *ValueBTree[V]) Range(low, high Bytes) iter.Seq2[Bytes, V] {
+	return b.RangeBounds(nilBounds(low, high))
+}
+
+// Backward iterates over the pairs with keys in [low, high) in descending order, nil bounds are unbounded
+func (b *ValueBTree[V]) Backward(low, high Bytes) iter.Seq2[Bytes, V] {
+	return b.BackwardBounds(nilBounds(low, high))
+}
+
+// RangeBounds iterates over the pairs with keys between lo and hi in ascending order
+func (b *ValueBTree[V]) RangeBounds(lo, hi Bounds) iter.Seq2[Bytes, V] {
+	return rangeBounds(&b.treeCore, lo, hi)
+}
+
+// BackwardBounds iterates over the pairs with keys between lo and hi in descending order
+func (b *ValueBTree[V]) BackwardBounds(lo, hi Bounds) iter.Seq2[Bytes, V] {
+	return backwardBounds(&b.treeCore, lo, hi)
+}
@@ -0,0 +1,70 @@
+package btree
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNewValueBTreeValidatesDegree(t *testing.T) {
+	for _, deg := range []int{-1, 0, 1, 2} {
+		if _, err := NewValueBTree[int](deg, 0); !errors.Is(err, ErrInvalidDegree) {
+			t.Errorf("degree %d: got error %v", deg, err)
+		}
+	}
+}
+
+func TestValueBTreeClone(t *testing.T) {
+	b := must[*ValueBTree[int]](t)(NewValueBTree[int](4, 4))
+	for i := range 1000 {
+		if err := b.Set(Bytes{byte(i / 256), byte(i)}, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c := b.Clone()
+	for i := range 1000 {
+		var err error
+		if i%2 == 0 {
+			_, err = c.Del(Bytes{byte(i / 256), byte(i)})
+		} else {
+			err = c.Set(Bytes{byte(i / 256), byte(i)}, -i)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for i := range 1000 {
+		if v, ok := b.Get(Bytes{byte(i / 256), byte(i)}); !ok || v != i {
+			t.Fatalf("clone modified the tree at %d", i)
+		}
+	}
+	if c.Len() != 500 || c.Validate() != nil || b.Validate() != nil {
+		t.Fatalf("clone has %d keys", c.Len())
+	}
+}
+
+// Updating and reading inline values must not allocate
+func TestValueBTreeNoAllocs(t *testing.T) {
+	b := must[*ValueBTree[int64]](t)(NewValueBTree[int64](16, 4))
+	keys, _ := GetData(1000)
+	for i := range keys {
+		if err := b.Set(keys[i][:], int64(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	i := 0
+	var err error
+	allocs := testing.AllocsPerRun(1000, func() {
+		k := keys[i%len(keys)][:]
+		if e := b.Set(k, int64(i)); e != nil {
+			err = e
+		}
+		b.Get(k)
+		i++
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allocs != 0 {
+		t.Fatalf("%v allocations per update", allocs)
+	}
+}
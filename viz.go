@@ -0,0 +1,321 @@
+package btree
+
+import (
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"strings"
+)
+
+// WriteDOT writes the structure of the tree in the Graphviz DOT format, with a record for every node,
+// edges from internal nodes to their children, and dashed edges for the next links between leaves.
+// Keys of printable ASCII characters are shown as they are, and other keys in hex.
+func (b *BTree[V]) WriteDOT(w io.Writer) error {
+	var sb strings.Builder
+	ids := map[Node[*V]]int{}
+	levels := treeLevels(b.root)
+	for _, level := range levels {
+		for _, n := range level {
+			ids[n] = len(ids)
+		}
+	}
+
+	sb.WriteString("digraph btree {\n\tnode [shape=record, fontname=monospace];\n")
+	for _, level := range levels {
+		for _, n := range level {
+			switch n := n.(type) {
+			case *InternalNode[*V]:
+				labels := make([]string, 0, 2*n.len())
+				for i := range n.pointers {
+					if i > 0 {
+						labels = append(labels, dotEscape(keyLabel(n.key(i-1))))
+					}
+					labels = append(labels, fmt.Sprintf("<p%d>", i))
+				}
+				fmt.Fprintf(&sb, "\tn%d [label=\"%s\"];\n", ids[n], strings.Join(labels, "|"))
+				for i, c := range n.pointers {
+					fmt.Fprintf(&sb, "\tn%d:p%d -> n%d;\n", ids[n], i, ids[c])
+				}
+			case *LeafNode[*V]:
+				labels := make([]string, n.len())
+				for i, k := range n.fullKeys() {
+					labels[i] = dotEscape(keyLabel(k))
+				}
+				if len(labels) == 0 {
+					labels = append(labels, " ")
+				}
+				fmt.Fprintf(&sb, "\tn%d [label=\"%s\", style=filled, fillcolor=lightblue];\n", ids[n], strings.Join(labels, "|"))
+			}
+		}
+	}
+
+	// next links, which can point to leaves outside the tree after it's cloned, see LeafNode.clone
+	leaves := levels[len(levels)-1]
+	sb.WriteString("\t{rank=same;")
+	for _, l := range leaves {
+		fmt.Fprintf(&sb, " n%d;", ids[l])
+	}
+	sb.WriteString("}\n")
+	for _, l := range leaves {
+		if next, ok := ids[l.(*LeafNode[*V]).next]; ok {
+			fmt.Fprintf(&sb, "\tn%d -> n%d [style=dashed, color=red, constraint=false];\n", ids[l], next)
+		}
+	}
+	sb.WriteString("}\n")
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// treeLevels returns the nodes of each level of the tree from left to right, starting at the root
+func treeLevels[V any](root Node[V]) [][]Node[V] {
+	levels := [][]Node[V]{{root}}
+	for !levels[len(levels)-1][0].isLeaf() {
+		var next []Node[V]
+		for _, n := range levels[len(levels)-1] {
+			next = append(next, n.(*InternalNode[V]).pointers...)
+		}
+		levels = append(levels, next)
+	}
+	return levels
+}
+
+func keyLabel(k Bytes) string {
+	for _, c := range k {
+		if c < 0x20 || c > 0x7e {
+			return "0x" + hex.EncodeToString(k)
+		}
+	}
+	return string(k)
+}
+
+// dotEscape escapes the characters that have a meaning in record labels
+func dotEscape(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if strings.ContainsRune(`{}|<>"\ `, r) {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// Layout of the PNG rendering, in pixels
+const (
+	vizScale     = 2              // size of a glyph pixel
+	vizCharW     = 4 * vizScale   // glyph advance
+	vizPtrW      = 3 * vizScale   // width of a pointer slot of internal nodes
+	vizNodeH     = 5*vizScale + 8 // height of a node
+	vizLevelGap  = 60             // vertical space between levels
+	vizNodeGap   = 12             // minimum horizontal space between nodes
+	vizMargin    = 20             // space around the tree
+	vizMaxPixels = 1 << 26        // largest image that is rendered
+	vizLabelMax  = 64             // largest PNGOptions.LabelBytes
+	vizElided    = ".."           // replaces the prefix shared by the keys of a node in labels
+)
+
+var (
+	vizBackground = color.RGBA{0xff, 0xff, 0xff, 0xff}
+	vizBorder     = color.RGBA{0x20, 0x20, 0x20, 0xff}
+	vizKeyFill    = color.RGBA{0xad, 0xd8, 0xe6, 0xff}
+	vizPtrFill    = color.RGBA{0xd0, 0xd0, 0xd0, 0xff}
+	vizEdge       = color.RGBA{0x70, 0x70, 0x70, 0xff}
+	vizNextEdge   = color.RGBA{0xd0, 0x20, 0x20, 0xff}
+)
+
+// vizFont has 3x5 glyphs for hex digits and '.', every row is 3 bits from left to right
+var vizFont = map[rune][5]uint8{
+	'0': {7, 5, 5, 5, 7}, '1': {2, 6, 2, 2, 7}, '2': {7, 1, 7, 4, 7}, '3': {7, 1, 7, 1, 7},
+	'4': {5, 5, 7, 1, 1}, '5': {7, 4, 7, 1, 7}, '6': {7, 4, 7, 5, 7}, '7': {7, 1, 1, 1, 1},
+	'8': {7, 5, 7, 5, 7}, '9': {7, 5, 7, 1, 7}, 'a': {2, 5, 7, 5, 5}, 'b': {6, 5, 6, 5, 6},
+	'c': {7, 4, 4, 4, 7}, 'd': {6, 5, 5, 5, 6}, 'e': {7, 4, 6, 4, 7}, 'f': {7, 4, 6, 4, 4},
+	'.': {0, 0, 0, 0, 2},
+}
+
+// PNGOptions configures WritePNGOptions
+type PNGOptions struct {
+	// LabelBytes is the number of bytes of each key shown in hex, 3 if zero and at most 64. The prefix
+	// shared by all keys of a node is left out of their labels and shown as "..", so that labels show the
+	// bytes that tell the keys of a node apart even when keys have long common prefixes.
+	LabelBytes int
+}
+
+type vizBox struct {
+	x, y, w int
+}
+
+// WritePNG renders the tree as a PNG image with the default options, see WritePNGOptions
+func (b *BTree[V]) WritePNG(w io.Writer) error {
+	return b.WritePNGOptions(w, PNGOptions{})
+}
+
+// WritePNGOptions renders the tree as a PNG image. Nodes are drawn with a slot for every key they can
+// hold, filled slots are labelled with the key in hex, see PNGOptions. Edges go from the pointer slots of
+// internal nodes to their children, and next links between leaves are drawn in red.
+// It's meant for small trees, larger trees return an error instead of allocating a huge image.
+func (b *BTree[V]) WritePNGOptions(w io.Writer, opts PNGOptions) error {
+	if opts.LabelBytes == 0 {
+		opts.LabelBytes = 3
+	}
+	if opts.LabelBytes < 0 || opts.LabelBytes > vizLabelMax {
+		return fmt.Errorf("btree: label size must be between 1 and %d bytes, got %d", vizLabelMax, opts.LabelBytes)
+	}
+	// labels are the elision mark and two hex digits per byte, with a glyph pixel of padding on both sides
+	keyW := (len(vizElided)+2*opts.LabelBytes)*vizCharW + 2*vizScale
+	levels := treeLevels(b.root)
+	boxes := map[Node[*V]]*vizBox{}
+
+	// leaves are placed left to right, and each internal node is centered over its children
+	x := vizMargin
+	for _, n := range levels[len(levels)-1] {
+		l := n.(*LeafNode[*V])
+		boxes[n] = &vizBox{x: x, w: cap(l.keys) * keyW}
+		x += boxes[n].w + vizNodeGap
+	}
+	width := x - vizNodeGap + vizMargin
+	for i := len(levels) - 2; i >= 0; i-- {
+		right := vizMargin - vizNodeGap
+		for _, n := range levels[i] {
+			t := n.(*InternalNode[*V])
+			first, last := boxes[t.pointers[0]], boxes[t.pointers[t.len()-1]]
+			box := &vizBox{w: cap(t.keys)*keyW + cap(t.pointers)*vizPtrW}
+			box.x = max((first.x+last.x+last.w)/2-box.w/2, right+vizNodeGap)
+			right = box.x + box.w
+			boxes[n] = box
+		}
+		width = max(width, right+vizMargin)
+	}
+	for i, level := range levels {
+		for _, n := range level {
+			boxes[n].y = vizMargin + i*(vizNodeH+vizLevelGap)
+		}
+	}
+	height := 2*vizMargin + len(levels)*vizNodeH + (len(levels)-1)*vizLevelGap
+	if width*height > vizMaxPixels {
+		return fmt.Errorf("btree: tree too large to render, the image would be %dx%d", width, height)
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.Draw(img, img.Bounds(), image.NewUniform(vizBackground), image.Point{}, draw.Src)
+	for _, level := range levels {
+		for _, n := range level {
+			box := boxes[n]
+			switch n := n.(type) {
+			case *InternalNode[*V]:
+				x, labels := box.x, keyLabels(n.fullKeys(), opts.LabelBytes)
+				for i := range cap(n.pointers) {
+					if i < n.len() {
+						fillRect(img, x, box.y, vizPtrW, vizNodeH, vizPtrFill)
+						c := boxes[n.pointers[i]]
+						drawLine(img, x+vizPtrW/2, box.y+vizNodeH, c.x+c.w/2, c.y, vizEdge)
+					}
+					x += vizPtrW
+					if i < cap(n.keys) {
+						drawKeySlot(img, x, box.y, keyW, labels, i)
+						x += keyW
+					}
+				}
+			case *LeafNode[*V]:
+				labels := keyLabels(n.fullKeys(), opts.LabelBytes)
+				for i := range cap(n.keys) {
+					drawKeySlot(img, box.x+i*keyW, box.y, keyW, labels, i)
+				}
+				if next, ok := boxes[n.next]; ok {
+					y := box.y + vizNodeH/2
+					drawLine(img, box.x+box.w, y, next.x, y, vizNextEdge)
+				}
+			}
+			strokeRect(img, box.x, box.y, box.w, vizNodeH, vizBorder)
+		}
+	}
+	return png.Encode(w, img)
+}
+
+// keyLabels returns the labels of the keys of a node: up to size bytes in hex of each key after the
+// prefix shared by all of them, which is replaced with vizElided
+func keyLabels(keys []Bytes, size int) []string {
+	shared := 0
+	if len(keys) > 1 {
+		shared = len(keys[0])
+		for _, k := range keys[1:] {
+			shared = min(shared, commonPrefixLen(keys[0], k))
+		}
+	}
+	labels := make([]string, len(keys))
+	for i, k := range keys {
+		k = k[shared:]
+		labels[i] = hex.EncodeToString(k[:min(len(k), size)])
+		if shared > 0 {
+			labels[i] = vizElided + labels[i]
+		}
+	}
+	return labels
+}
+
+// drawKeySlot draws the slot of width w of labels[i] with its left edge at x, or an empty slot if there
+// is no such label
+func drawKeySlot(img *image.RGBA, x, y, w int, labels []string, i int) {
+	if i < len(labels) {
+		fillRect(img, x, y, w, vizNodeH, vizKeyFill)
+		drawText(img, x+vizScale, y+4, labels[i], vizBorder)
+	}
+	strokeRect(img, x, y, w, vizNodeH, vizEdge)
+}
+
+func fillRect(img *image.RGBA, x, y, w, h int, c color.RGBA) {
+	draw.Draw(img, image.Rect(x, y, x+w, y+h), image.NewUniform(c), image.Point{}, draw.Src)
+}
+
+func strokeRect(img *image.RGBA, x, y, w, h int, c color.RGBA) {
+	drawLine(img, x, y, x+w-1, y, c)
+	drawLine(img, x, y+h-1, x+w-1, y+h-1, c)
+	drawLine(img, x, y, x, y+h-1, c)
+	drawLine(img, x+w-1, y, x+w-1, y+h-1, c)
+}
+
+// drawLine draws a line between two points with Bresenham's algorithm
+func drawLine(img *image.RGBA, x0, y0, x1, y1 int, c color.RGBA) {
+	dx, dy := abs(x1-x0), -abs(y1-y0)
+	sx, sy := 1, 1
+	if x0 > x1 {
+		sx = -1
+	}
+	if y0 > y1 {
+		sy = -1
+	}
+	e := dx + dy
+	for {
+		img.SetRGBA(x0, y0, c)
+		if x0 == x1 && y0 == y1 {
+			return
+		}
+		e2 := 2 * e
+		if e2 >= dy {
+			e += dy
+			x0 += sx
+		}
+		if e2 <= dx {
+			e += dx
+			y0 += sy
+		}
+	}
+}
+
+func drawText(img *image.RGBA, x, y int, s string, c color.RGBA) {
+	for _, r := range s {
+		glyph := vizFont[r]
+		for row, bits := range glyph {
+			for col := range 3 {
+				if bits&(4>>col) != 0 {
+					fillRect(img, x+col*vizScale, y+row*vizScale, vizScale, vizScale, c)
+				}
+			}
+		}
+		x += vizCharW
+	}
+}
@@ -0,0 +1,104 @@
+package btree
+
+import (
+	"bytes"
+	"image/png"
+	"io"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestWriteDOT(t *testing.T) {
+	b, err := BuildFromSorted(4, sortedPairs(sortedTestKeys(48)), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := b.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	dot := buf.String()
+
+	if !strings.HasPrefix(dot, "digraph btree {") || !strings.HasSuffix(dot, "}\n") {
+		t.Fatalf("not a digraph:\n%s", dot)
+	}
+	// 5 internal nodes with 20 child edges, and 16 leaves with 15 next links
+	if n := strings.Count(dot, "[label="); n != 21 {
+		t.Errorf("got %d nodes", n)
+	}
+	if n := strings.Count(dot, ":p"); n != 20 {
+		t.Errorf("got %d child edges", n)
+	}
+	if n := strings.Count(dot, "style=dashed"); n != 15 {
+		t.Errorf("got %d next links", n)
+	}
+	if !strings.Contains(dot, `label="00000000|00000001|00000002"`) {
+		t.Errorf("first leaf not found:\n%s", dot)
+	}
+}
+
+func TestWriteDOTEscaping(t *testing.T) {
+	b := NewBTree[int](4, 4)
+	b.SetOp(Bytes("a|b c"), nil)
+	b.SetOp(Bytes{0x00, 0xff}, nil)
+	var buf bytes.Buffer
+	if err := b.WriteDOT(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), `label="0x00ff|a\|b\ c"`) {
+		t.Errorf("keys not escaped:\n%s", buf.String())
+	}
+}
+
+func TestWritePNG(t *testing.T) {
+	keys := sortedTestKeys(48)
+	for i := range keys {
+		keys[i] = append(Bytes("tenant-0123456789/"), keys[i]...)
+	}
+	b, err := BuildFromSorted(4, sortedPairs(keys), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, labelBytes := range []int{0, 1, 8} {
+		var buf bytes.Buffer
+		if err := b.WritePNGOptions(&buf, PNGOptions{LabelBytes: labelBytes}); err != nil {
+			t.Fatal(err)
+		}
+		img, err := png.Decode(&buf)
+		if err != nil {
+			t.Fatalf("rendered image can't be decoded: %v", err)
+		}
+		// 16 leaves with 3 key slots side by side, under 2 levels of internal nodes
+		shown := labelBytes
+		if shown == 0 {
+			shown = 3
+		}
+		keyW := (len(vizElided)+2*shown)*vizCharW + 2*vizScale
+		wantW := 2*vizMargin + 16*3*keyW + 15*vizNodeGap
+		wantH := 2*vizMargin + 3*vizNodeH + 2*vizLevelGap
+		if img.Bounds().Dx() != wantW || img.Bounds().Dy() != wantH {
+			t.Errorf("label size %d: image is %v, expected %dx%d", labelBytes, img.Bounds(), wantW, wantH)
+		}
+	}
+
+	if err := b.WritePNGOptions(io.Discard, PNGOptions{LabelBytes: -1}); err == nil {
+		t.Errorf("negative label size accepted")
+	}
+	big, _, _ := buildComparableMaps(5000, 4)
+	if err := big.WritePNG(io.Discard); err == nil {
+		t.Errorf("huge tree rendered")
+	}
+}
+
+// Labels of keys with a long common prefix must show the bytes that tell them apart
+func TestKeyLabels(t *testing.T) {
+	keys := []Bytes{Bytes("tenant-0123456789/a1"), Bytes("tenant-0123456789/a2"), Bytes("tenant-0123456789/b")}
+	if got := keyLabels(keys, 2); !slices.Equal(got, []string{"..6131", "..6132", "..62"}) {
+		t.Errorf("got labels %q", got)
+	}
+	if got := keyLabels(keys[:1], 2); !slices.Equal(got, []string{"7465"}) {
+		t.Errorf("got label %q for a single key", got)
+	}
+}
@@ -0,0 +1,495 @@
+package btree
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"iter"
+	"os"
+	"path/filepath"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	walOpSet    byte = 1
+	walOpSetNil byte = 2 // set with a nil value, which has no encoding
+	walOpDel    byte = 3
+
+	walHeaderSize = 4 + 4 // payload length, payload checksum
+)
+
+var (
+	ErrClosed = errors.New("btree: tree is closed")
+
+	walTable = crc32.MakeTable(crc32.Castagnoli)
+)
+
+// DurableOptions configures a DurableBTree
+type DurableOptions[V any] struct {
+	Degree int
+	// SyncInterval is the group commit interval. With 0, every write syncs the log before returning.
+	// Otherwise the log is synced every SyncInterval, and writes return once the sync covering them
+	// is done, so concurrent writers share syncs.
+	SyncInterval time.Duration
+	// EncodeValue appends the encoding of v to dst
+	EncodeValue func(dst []byte, v *V) []byte
+	DecodeValue func(b []byte) (*V, error)
+}
+
+// DurableBTree is a BTree whose modifications are first appended to a write-ahead log,
+// which is replayed on open to rebuild the tree. A write is on stable storage once SetOp or DelOp returns.
+// Writes are only applied to the tree once their record is on stable storage, so readers never see a write
+// that a crash could lose, and a write is visible to all readers by the time SetOp or DelOp returns.
+// DurableBTree is safe for concurrent use, but the tree must not be modified while iterating over it.
+type DurableBTree[V any] struct {
+	mu      sync.RWMutex
+	synced  *sync.Cond // broadcast after every group commit, uses mu
+	syncing sync.Mutex // held during group commits and compaction, must be acquired before mu
+	tree    *BTree[V]
+	opts    DurableOptions[V]
+	path    string
+	file    *os.File
+	w       *bufio.Writer
+	buf     []byte // scratch buffer for encoding records
+	// pending holds the records that were appended but aren't known to be durable yet, in log order.
+	// They are applied to the tree by applyDurable.
+	pending []walRecord[V]
+
+	appended uint64 // number of records appended since open
+	durable  uint64 // number of records known to be on stable storage
+	err      error  // sticky error of a failed write or sync, the log can't be appended to after it
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// walRecord is a write that was appended to the log as record number seq
+type walRecord[V any] struct {
+	seq   uint64
+	op    byte
+	key   Bytes
+	value *V
+}
+
+// OpenDurableBTree opens or creates the log at path and replays it. A torn or corrupt record at the end of
+// the log, left behind by a crash during a write, is discarded along with everything after it.
+// A record that is intact but can't be applied, for example because DecodeValue fails on it, is an error,
+// and the log is left as it is.
+func OpenDurableBTree[V any](path string, opts DurableOptions[V]) (*DurableBTree[V], error) {
+	if opts.EncodeValue == nil || opts.DecodeValue == nil {
+		return nil, errors.New("btree: durable tree needs value encoding functions")
+	}
+	if opts.Degree < 3 {
+		return nil, fmt.Errorf("%w, got %d", ErrInvalidDegree, opts.Degree)
+	}
+	if opts.SyncInterval < 0 {
+		return nil, fmt.Errorf("btree: sync interval must not be negative, got %v", opts.SyncInterval)
+	}
+
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &DurableBTree[V]{
+		tree: NewBTree[V](opts.Degree, 4),
+		opts: opts,
+		path: path,
+		file: f,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	d.synced = sync.NewCond(&d.mu)
+
+	if err := d.replay(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	d.w = bufio.NewWriter(f)
+
+	if opts.SyncInterval > 0 {
+		go d.groupCommitLoop()
+	} else {
+		close(d.done)
+	}
+	return d, nil
+}
+
+// replay applies all complete records of the log to the tree, and truncates the log after the last one.
+// Only a short read or a checksum mismatch ends the log, records that can't be applied are errors.
+func (d *DurableBTree[V]) replay() error {
+	st, err := d.file.Stat()
+	if err != nil {
+		return err
+	}
+	r := bufio.NewReader(d.file)
+	var valid int64 // offset after the last valid record
+	var header [walHeaderSize]byte
+
+	for {
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return err
+		}
+
+		size := binary.LittleEndian.Uint32(header[0:])
+		sum := binary.LittleEndian.Uint32(header[4:])
+		// the header isn't checked by the checksum, a torn one can have any size
+		if int64(size) > st.Size()-valid-walHeaderSize {
+			break
+		}
+		payload := make([]byte, size)
+		if _, err := io.ReadFull(r, payload); err != nil {
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				break
+			}
+			return err
+		}
+		if crc32.Checksum(payload, walTable) != sum {
+			break
+		}
+		if err := d.apply(payload); err != nil {
+			return fmt.Errorf("btree: applying log record at offset %d: %w", valid, err)
+		}
+		valid += walHeaderSize + int64(size)
+	}
+
+	if err := d.file.Truncate(valid); err != nil {
+		return err
+	}
+	if _, err := d.file.Seek(valid, io.SeekStart); err != nil {
+		return err
+	}
+	return d.file.Sync()
+}
+
+// apply applies the payload of a log record to the tree
+func (d *DurableBTree[V]) apply(payload []byte) error {
+	if len(payload) == 0 {
+		return errors.New("btree: empty log record")
+	}
+	op := payload[0]
+	keyLen, n := binary.Uvarint(payload[1:])
+	if n <= 0 || uint64(len(payload)-1-n) < keyLen {
+		return errors.New("btree: bad key length in log record")
+	}
+	key := payload[1+n : 1+n+int(keyLen)]
+	rest := payload[1+n+int(keyLen):]
+
+	switch op {
+	case walOpSet:
+		v, err := d.opts.DecodeValue(rest)
+		if err != nil {
+			return err
+		}
+		return d.tree.SetOp(key, v)
+	case walOpSetNil:
+		return d.tree.SetOp(key, nil)
+	case walOpDel:
+		_, err := d.tree.DelOp(key)
+		return err
+	default:
+		return fmt.Errorf("btree: unknown log record type %d", op)
+	}
+}
+
+// write appends a record for a write to the log, to be applied once it's durable. Must be called with mu
+// held, and followed by waitDurable.
+func (d *DurableBTree[V]) write(op byte, key Bytes, value *V) error {
+	if err := d.appendRecord(op, key, value); err != nil {
+		return err
+	}
+	d.pending = append(d.pending, walRecord[V]{seq: d.appended, op: op, key: key, value: value})
+	return nil
+}
+
+// applyDurable applies the pending records that are on stable storage to the tree, in log order.
+// Must be called with mu held whenever durable grows.
+func (d *DurableBTree[V]) applyDurable() {
+	n := 0
+	for ; n < len(d.pending) && d.pending[n].seq <= d.durable && d.err == nil; n++ {
+		r := d.pending[n]
+		if r.op == walOpDel {
+			_, d.err = d.tree.DelOp(r.key)
+		} else {
+			d.err = d.tree.SetOp(r.key, r.value)
+		}
+	}
+	d.pending = slices.Delete(d.pending, 0, n)
+}
+
+// appendRecord writes a record to the log buffer, must be called with mu held
+func (d *DurableBTree[V]) appendRecord(op byte, key Bytes, value *V) error {
+	if d.err != nil {
+		return d.err
+	}
+
+	buf := append(d.buf[:0], make([]byte, walHeaderSize)...)
+	buf = append(buf, op)
+	buf = binary.AppendUvarint(buf, uint64(len(key)))
+	buf = append(buf, key...)
+	if op == walOpSet {
+		buf = d.opts.EncodeValue(buf, value)
+	}
+	payload := buf[walHeaderSize:]
+	binary.LittleEndian.PutUint32(buf[0:], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:], crc32.Checksum(payload, walTable))
+	d.buf = buf
+
+	if _, err := d.w.Write(buf); err != nil {
+		d.err = err
+		return err
+	}
+	d.appended++
+	return nil
+}
+
+// waitDurable returns once record number seq is on stable storage and applied, must be called with mu held
+func (d *DurableBTree[V]) waitDurable(seq uint64) error {
+	if d.opts.SyncInterval == 0 {
+		return d.syncLocked()
+	}
+	for d.durable < seq && d.err == nil {
+		d.synced.Wait()
+	}
+	return d.err
+}
+
+// syncLocked flushes and syncs the log while holding mu
+func (d *DurableBTree[V]) syncLocked() error {
+	if d.err != nil {
+		return d.err
+	}
+	if err := d.w.Flush(); err != nil {
+		d.err = err
+		return err
+	}
+	if err := d.file.Sync(); err != nil {
+		d.err = err
+		return err
+	}
+	d.durable = d.appended
+	d.applyDurable()
+	return d.err
+}
+
+// groupCommitLoop syncs the log every SyncInterval. The file is synced without holding mu,
+// so that writers can keep appending to the buffer during the sync.
+func (d *DurableBTree[V]) groupCommitLoop() {
+	defer close(d.done)
+	ticker := time.NewTicker(d.opts.SyncInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-d.stop:
+			return
+		case <-ticker.C:
+		}
+
+		d.groupCommit()
+	}
+}
+
+func (d *DurableBTree[V]) groupCommit() {
+	d.syncing.Lock()
+	defer d.syncing.Unlock()
+
+	d.mu.Lock()
+	if d.durable == d.appended || d.err != nil {
+		d.mu.Unlock()
+		return
+	}
+	target, f := d.appended, d.file
+	err := d.w.Flush()
+	d.mu.Unlock()
+
+	if err == nil {
+		err = f.Sync()
+	}
+
+	d.mu.Lock()
+	if err != nil {
+		d.err = err
+	} else {
+		d.durable = max(d.durable, target)
+		d.applyDurable()
+	}
+	d.synced.Broadcast()
+	d.mu.Unlock()
+}
+
+func (d *DurableBTree[V]) Len() int {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.tree.Len()
+}
+
+func (d *DurableBTree[V]) GetOp(key Bytes) *V {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.tree.GetOp(key)
+}
+
+// SetOp logs the set and applies it once the record is on stable storage, which is when it returns
+func (d *DurableBTree[V]) SetOp(key Bytes, value *V) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	op := walOpSet
+	if value == nil {
+		op = walOpSetNil
+	}
+	if err := d.write(op, key, value); err != nil {
+		return err
+	}
+	return d.waitDurable(d.appended)
+}
+
+// DelOp logs the deletion and applies it once the record is on stable storage, which is when it returns.
+// Deletion of keys that don't exist isn't logged.
+func (d *DurableBTree[V]) DelOp(key Bytes) (bool, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if !d.contains(key) {
+		return false, d.err
+	}
+	if err := d.write(walOpDel, key, nil); err != nil {
+		return false, err
+	}
+	if err := d.waitDurable(d.appended); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// contains returns whether key exists once the pending records are applied. It's used instead of GetOp as
+// the tree can hold nil values.
+func (d *DurableBTree[V]) contains(key Bytes) bool {
+	for _, r := range slices.Backward(d.pending) {
+		if bytes.Equal(r.key, key) {
+			return r.op != walOpDel
+		}
+	}
+	l, _ := leafAndPathForKey(d.tree.root, key, nil)
+	_, exists := l.search(key)
+	return exists
+}
+
+// All iterates over all pairs while holding a read lock, the tree must not be modified inside the loop
+func (d *DurableBTree[V]) All() iter.Seq2[Bytes, *V] {
+	return d.Range(nil, nil)
+}
+
+// Range iterates over the pairs with keys in [low, high) while holding a read lock,
+// the tree must not be modified inside the loop
+func (d *DurableBTree[V]) Range(low, high Bytes) iter.Seq2[Bytes, *V] {
+	return func(yield func(Bytes, *V) bool) {
+		d.mu.RLock()
+		defer d.mu.RUnlock()
+		for k, v := range d.tree.Range(low, high) {
+			if !yield(k, v) {
+				return
+			}
+		}
+	}
+}
+
+// Sync forces a sync of all appended records
+func (d *DurableBTree[V]) Sync() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err := d.syncLocked()
+	d.synced.Broadcast()
+	return err
+}
+
+// Compact replaces the log with a minimal one that holds one record per key of the tree
+func (d *DurableBTree[V]) Compact() error {
+	d.syncing.Lock()
+	defer d.syncing.Unlock()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	// the sync of the old log and the compacted one both make records durable, and the group commit
+	// that writers wait for has nothing left to sync afterward
+	defer d.synced.Broadcast()
+	if err := d.syncLocked(); err != nil {
+		return err
+	}
+
+	tmpPath := d.path + ".compact"
+	tmp, err := os.Create(tmpPath)
+	if err != nil {
+		return err
+	}
+	old, oldW, appended, durable := d.file, d.w, d.appended, d.durable
+	d.file, d.w = tmp, bufio.NewWriter(tmp)
+
+	for k, v := range d.tree.All() {
+		op := walOpSet
+		if v == nil {
+			op = walOpSetNil
+		}
+		if err = d.appendRecord(op, k, v); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = d.syncLocked()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, d.path)
+	}
+	if err != nil {
+		// keep appending to the old log
+		d.err = nil
+		d.file, d.w, d.appended, d.durable = old, oldW, appended, durable
+		_ = tmp.Close()
+		_ = os.Remove(tmpPath)
+		return err
+	}
+
+	// the old log is unlinked once renamed over, so the compacted one is kept even if the rename
+	// can't be made durable
+	err = syncDir(filepath.Dir(d.path))
+	return errors.Join(err, old.Close())
+}
+
+// syncDir makes renames in the directory durable
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	return errors.Join(err, f.Close())
+}
+
+// Close syncs the log and closes it, the tree can't be used afterward
+func (d *DurableBTree[V]) Close() error {
+	select {
+	case <-d.stop:
+		return ErrClosed
+	default:
+		close(d.stop)
+	}
+	<-d.done
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err := d.syncLocked()
+	if d.err == nil {
+		d.err = ErrClosed
+	}
+	d.synced.Broadcast()
+	return errors.Join(err, d.file.Close())
+}
@@ -0,0 +1,347 @@
+package btree
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func intDurableOptions(syncInterval time.Duration) DurableOptions[int] {
+	return DurableOptions[int]{
+		Degree:       4,
+		SyncInterval: syncInterval,
+		EncodeValue: func(dst []byte, v *int) []byte {
+			return binary.AppendVarint(dst, int64(*v))
+		},
+		DecodeValue: func(b []byte) (*int, error) {
+			v, n := binary.Varint(b)
+			if n <= 0 {
+				return nil, errors.New("bad varint")
+			}
+			i := int(v)
+			return &i, nil
+		},
+	}
+}
+
+func openTestDurableTree(t *testing.T, path string, syncInterval time.Duration) *DurableBTree[int] {
+	t.Helper()
+	d, err := OpenDurableBTree(path, intDurableOptions(syncInterval))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	return d
+}
+
+func walKey(i int) Bytes {
+	return Bytes(fmt.Sprintf("key-%05d", i))
+}
+
+// checkDurableContents checks that keys [0, n) are present with value i*i and no other keys exist
+func checkDurableContents(t *testing.T, d *DurableBTree[int], n int) {
+	t.Helper()
+	for i := range n {
+		v := d.GetOp(walKey(i))
+		if v == nil || *v != i*i {
+			t.Fatalf("key %d: got %v, want %d", i, v, i*i)
+		}
+	}
+	count := 0
+	for range d.All() {
+		count++
+	}
+	if count != n {
+		t.Fatalf("expected %d keys, got %d", n, count)
+	}
+}
+
+func TestDurableReplay(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.wal")
+	d := openTestDurableTree(t, path, 0)
+
+	for i := range 300 {
+		v := -1
+		if err := d.SetOp(walKey(i), &v); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+	}
+	// overwrite the first 200 and delete the rest
+	for i := range 300 {
+		if i >= 200 {
+			if del, err := d.DelOp(walKey(i)); !del || err != nil {
+				t.Fatalf("delete: %v %v", del, err)
+			}
+			continue
+		}
+		v := i * i
+		if err := d.SetOp(walKey(i), &v); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if err := d.SetOp(walKey(0), nil); !errors.Is(err, ErrClosed) {
+		t.Fatalf("expected ErrClosed after close, got %v", err)
+	}
+
+	d = openTestDurableTree(t, path, 0)
+	defer d.Close()
+	checkDurableContents(t, d, 200)
+	if d.Len() != 200 {
+		t.Fatalf("expected Len 200 after replay, got %d", d.Len())
+	}
+}
+
+// A crash in the middle of an append leaves a partial record, which must be dropped on open
+func TestDurableTornLastRecord(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		corrupt func(t *testing.T, path string, lastRecordAt int64)
+	}{
+		{"truncated payload", func(t *testing.T, path string, _ int64) {
+			st, _ := os.Stat(path)
+			if err := os.Truncate(path, st.Size()-3); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"truncated header", func(t *testing.T, path string, lastRecordAt int64) {
+			if err := os.Truncate(path, lastRecordAt+walHeaderSize/2); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"huge size", func(t *testing.T, path string, lastRecordAt int64) {
+			f, err := os.OpenFile(path, os.O_RDWR, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer f.Close()
+			if _, err := f.WriteAt([]byte{0xff, 0xff, 0xff, 0xff}, lastRecordAt); err != nil {
+				t.Fatal(err)
+			}
+		}},
+		{"bad checksum", func(t *testing.T, path string, _ int64) {
+			b, _ := os.ReadFile(path)
+			b[len(b)-1] ^= 0xff
+			if err := os.WriteFile(path, b, 0o644); err != nil {
+				t.Fatal(err)
+			}
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "tree.wal")
+			d := openTestDurableTree(t, path, 0)
+			for i := range 50 {
+				v := i * i
+				if err := d.SetOp(walKey(i), &v); err != nil {
+					t.Fatalf("set: %v", err)
+				}
+			}
+			st, _ := os.Stat(path)
+			validSize := st.Size()
+
+			v := 50 * 50
+			if err := d.SetOp(walKey(50), &v); err != nil {
+				t.Fatalf("set: %v", err)
+			}
+			if err := d.Close(); err != nil {
+				t.Fatalf("close: %v", err)
+			}
+			tc.corrupt(t, path, validSize)
+
+			d = openTestDurableTree(t, path, 0)
+			checkDurableContents(t, d, 50)
+			if st, _ := os.Stat(path); st.Size() != validSize {
+				t.Fatalf("torn record not truncated: size %d, want %d", st.Size(), validSize)
+			}
+
+			// the log must be usable after recovery
+			if err := d.SetOp(walKey(50), &v); err != nil {
+				t.Fatalf("set after recovery: %v", err)
+			}
+			if err := d.Close(); err != nil {
+				t.Fatalf("close: %v", err)
+			}
+			d = openTestDurableTree(t, path, 0)
+			defer d.Close()
+			checkDurableContents(t, d, 51)
+		})
+	}
+}
+
+func TestDurableGroupCommit(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.wal")
+	d := openTestDurableTree(t, path, time.Millisecond)
+
+	const writers, perWriter = 8, 50
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := w * perWriter; i < (w+1)*perWriter; i++ {
+				v := i * i
+				if err := d.SetOp(walKey(i), &v); err != nil {
+					t.Errorf("set: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	d = openTestDurableTree(t, path, 0)
+	defer d.Close()
+	checkDurableContents(t, d, writers*perWriter)
+}
+
+func TestDurableCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.wal")
+	d := openTestDurableTree(t, path, 0)
+	for round := range 5 {
+		for i := range 100 {
+			v := i * i
+			if round < 4 {
+				v = round
+			}
+			if err := d.SetOp(walKey(i), &v); err != nil {
+				t.Fatalf("set: %v", err)
+			}
+		}
+	}
+	before, _ := os.Stat(path)
+	if err := d.Compact(); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	after, _ := os.Stat(path)
+	if after.Size()*4 > before.Size() {
+		t.Errorf("log size went from %d to %d after compaction", before.Size(), after.Size())
+	}
+
+	v := 100 * 100
+	if err := d.SetOp(walKey(100), &v); err != nil {
+		t.Fatalf("set after compaction: %v", err)
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	d = openTestDurableTree(t, path, 0)
+	defer d.Close()
+	checkDurableContents(t, d, 101)
+}
+
+// Writers waiting for a group commit must be woken by a compaction that makes their records durable
+func TestDurableCompactWakesWriters(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.wal")
+	d := openTestDurableTree(t, path, time.Hour)
+	defer d.Close()
+
+	done := make(chan error)
+	go func() {
+		v := 0
+		done <- d.SetOp(walKey(0), &v)
+	}()
+	for appended := uint64(0); appended == 0; {
+		time.Sleep(time.Millisecond)
+		d.mu.Lock()
+		appended = d.appended
+		d.mu.Unlock()
+	}
+
+	if err := d.Compact(); err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("set: %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("writer still blocked after compaction")
+	}
+}
+
+// Readers must not see a write before its record is durable, and must see it once SetOp returns
+func TestDurableWritesVisibleOnceDurable(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.wal")
+	d := openTestDurableTree(t, path, time.Hour)
+	defer d.Close()
+
+	done := make(chan error)
+	go func() {
+		v := 1
+		done <- d.SetOp(walKey(0), &v)
+	}()
+	for appended := uint64(0); appended == 0; {
+		time.Sleep(time.Millisecond)
+		d.mu.Lock()
+		appended = d.appended
+		d.mu.Unlock()
+	}
+
+	if v := d.GetOp(walKey(0)); v != nil || d.Len() != 0 {
+		t.Fatalf("write visible before its record is durable: %v, Len %d", v, d.Len())
+	}
+	if err := d.Sync(); err != nil {
+		t.Fatalf("sync: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if v := d.GetOp(walKey(0)); v == nil || *v != 1 {
+		t.Fatalf("durable write not visible: %v", v)
+	}
+}
+
+// An intact record that can't be applied must fail the open instead of being dropped with the records after it
+func TestDurableReplayApplyError(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.wal")
+	d := openTestDurableTree(t, path, 0)
+	for i := range 50 {
+		v := i * i
+		if err := d.SetOp(walKey(i), &v); err != nil {
+			t.Fatalf("set: %v", err)
+		}
+	}
+	if err := d.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	before, _ := os.Stat(path)
+
+	errDecode := errors.New("can't decode")
+	opts := intDurableOptions(0)
+	decode := opts.DecodeValue
+	opts.DecodeValue = func(b []byte) (*int, error) {
+		v, err := decode(b)
+		if err == nil && *v == 25*25 {
+			return nil, errDecode
+		}
+		return v, err
+	}
+	if _, err := OpenDurableBTree(path, opts); !errors.Is(err, errDecode) {
+		t.Fatalf("expected the decoding error, got %v", err)
+	}
+	if after, _ := os.Stat(path); after.Size() != before.Size() {
+		t.Fatalf("log size went from %d to %d after a failed replay", before.Size(), after.Size())
+	}
+
+	d = openTestDurableTree(t, path, 0)
+	defer d.Close()
+	checkDurableContents(t, d, 50)
+}
+
+func TestDurableNegativeSyncInterval(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree.wal")
+	if _, err := OpenDurableBTree(path, intDurableOptions(-time.Second)); err == nil {
+		t.Fatal("expected error for a negative sync interval")
+	}
+}